@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	log "k8s.io/klog/v2"
+)
+
+var (
+	dbClusterResource   = schema.GroupVersionResource{Group: alloyDBGroup, Version: "v1", Resource: "dbclusters"}
+	backupResource      = schema.GroupVersionResource{Group: alloyDBGroup, Version: "v1", Resource: "backups"}
+	replicationResource = schema.GroupVersionResource{Group: alloyDBGroup, Version: "v1", Resource: "replications"}
+	dbInstanceResource  = schema.GroupVersionResource{Group: alloyDBGroup, Version: "v1", Resource: "dbinstances"}
+	instanceResource    = schema.GroupVersionResource{Group: alloyDBInternalGroup, Version: "v1", Resource: "instances"}
+)
+
+// alloyDBLister reads the AlloyDB resources the validators check references against, the getters return a
+// NotFound error from k8s.io/apimachinery/pkg/api/errors when there's no such resource.
+type alloyDBLister interface {
+	getDBCluster(namespace, name string) (*DBCluster, error)
+	getBackup(namespace, name string) (*Backup, error)
+	listBackups(namespace string) ([]*Backup, error)
+	listReplications(namespace string) ([]*Replication, error)
+	listDBInstances(namespace string) ([]*DBInstance, error)
+	getInstance(namespace, name string) (*Instance, error)
+}
+
+var alloyDB alloyDBLister
+
+// informerLister serves the AlloyDB resources from informers' caches, an informer is only started for the
+// resources a Build function asked to watch.
+type informerLister struct {
+	factory dynamicinformer.DynamicSharedInformerFactory
+	stop    <-chan struct{}
+
+	mu      sync.Mutex
+	listers map[schema.GroupVersionResource]cache.GenericLister
+}
+
+// watchAlloyDB makes alloyDB serve the resources, waiting for their caches to sync. The validators reading them are
+// gated on the alloydb config, which fails when the resources can't be watched.
+func watchAlloyDB(resources ...schema.GroupVersionResource) {
+	if failedConfigs["alloydb"] != nil {
+		return // Already reported
+	}
+	if alloyDB == nil {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			configFailed("alloydb", "handlers.watchAlloyDB():Could not load the in-cluster config for the Kubernetes client:: %v", err)
+			return
+		}
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			configFailed("alloydb", "handlers.watchAlloyDB():Could not create the Kubernetes client:: %v", err)
+			return
+		}
+		alloyDB = newInformerLister(client, make(chan struct{})) // Runs for the lifetime of the webhook
+	}
+	l, ok := alloyDB.(*informerLister)
+	if !ok {
+		return
+	}
+	if err := l.watch(resources...); err != nil {
+		configFailed("alloydb", "handlers.watchAlloyDB():Could not watch the AlloyDB resources:: %v", err)
+	}
+}
+
+func newInformerLister(client dynamic.Interface, stop <-chan struct{}) *informerLister {
+	return &informerLister{
+		factory: dynamicinformer.NewDynamicSharedInformerFactory(client, 0),
+		stop:    stop,
+		listers: map[schema.GroupVersionResource]cache.GenericLister{},
+	}
+}
+
+func (l *informerLister) watch(resources ...schema.GroupVersionResource) error {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	synced := []cache.InformerSynced{}
+	for _, gvr := range resources {
+		if _, ok := l.listers[gvr]; ok {
+			continue
+		}
+		informer := l.factory.ForResource(gvr)
+		l.listers[gvr] = informer.Lister()
+		synced = append(synced, informer.Informer().HasSynced)
+		log.Infof("handlers.informerLister.watch():Watching the %s", gvr.Resource)
+	}
+	l.factory.Start(l.stop)
+	if !cache.WaitForCacheSync(l.stop, synced...) {
+		return fmt.Errorf("the AlloyDB resource caches did not sync")
+	}
+	return nil
+
+}
+
+// get converts the resource from the cache into out.
+func (l *informerLister) get(gvr schema.GroupVersionResource, namespace, name string, out interface{}) error {
+
+	l.mu.Lock()
+	lister, ok := l.listers[gvr]
+	l.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("the %s aren't watched", gvr.Resource)
+	}
+	obj, err := lister.ByNamespace(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.(*unstructured.Unstructured).Object, out)
+
+}
+
+// list converts the resources of the namespace from the cache, newItem returns where to convert the next one into.
+func (l *informerLister) list(gvr schema.GroupVersionResource, namespace string, newItem func() interface{}) error {
+
+	l.mu.Lock()
+	lister, ok := l.listers[gvr]
+	l.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("the %s aren't watched", gvr.Resource)
+	}
+	objs, err := lister.ByNamespace(namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.(*unstructured.Unstructured).Object, newItem()); err != nil {
+			return err
+		}
+	}
+	return nil
+
+}
+
+func (l *informerLister) getDBCluster(namespace, name string) (*DBCluster, error) {
+	cluster := &DBCluster{}
+	if err := l.get(dbClusterResource, namespace, name, cluster); err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+func (l *informerLister) getBackup(namespace, name string) (*Backup, error) {
+	backup := &Backup{}
+	if err := l.get(backupResource, namespace, name, backup); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+func (l *informerLister) listBackups(namespace string) ([]*Backup, error) {
+	backups := []*Backup{}
+	err := l.list(backupResource, namespace, func() interface{} {
+		b := &Backup{}
+		backups = append(backups, b)
+		return b
+	})
+	if err != nil {
+		return nil, err
+	}
+	return backups, nil
+}
+
+func (l *informerLister) listReplications(namespace string) ([]*Replication, error) {
+	replications := []*Replication{}
+	err := l.list(replicationResource, namespace, func() interface{} {
+		r := &Replication{}
+		replications = append(replications, r)
+		return r
+	})
+	if err != nil {
+		return nil, err
+	}
+	return replications, nil
+}
+
+func (l *informerLister) listDBInstances(namespace string) ([]*DBInstance, error) {
+	instances := []*DBInstance{}
+	err := l.list(dbInstanceResource, namespace, func() interface{} {
+		i := &DBInstance{}
+		instances = append(instances, i)
+		return i
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+func (l *informerLister) getInstance(namespace, name string) (*Instance, error) {
+	instance := &Instance{}
+	if err := l.get(instanceResource, namespace, name, instance); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
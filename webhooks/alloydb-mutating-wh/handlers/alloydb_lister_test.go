@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestInformerLister(t *testing.T) {
+
+	setTestAlloyDB(t,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "dbcluster-sample", "labels": {"alloydb.cloud.google.com/protected": "true"}}, "spec": {"databaseVersion": "15.7.0"}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Backup", "metadata": {"namespace": "db", "name": "backup1"}, "spec": {"dbclusterRef": "dbcluster-sample", "backupPlanRef": "backupplan1"}}`,
+	)
+
+	cluster, err := alloyDB.getDBCluster("db", "dbcluster-sample")
+	if err != nil {
+		t.Fatalf("\t%s\tCould not get the DBCluster:: %v", failed, err)
+	}
+	if cluster.Spec.DatabaseVersion != "15.7.0" || cluster.Labels[protectedLabel] != "true" {
+		t.Errorf("\t%s\tGot the DBCluster %+v, want the version 15.7.0 & the protected label", failed, cluster)
+	}
+	backup, err := alloyDB.getBackup("db", "backup1")
+	if err != nil {
+		t.Fatalf("\t%s\tCould not get the Backup:: %v", failed, err)
+	}
+	if backup.Spec.DBClusterRef != "dbcluster-sample" {
+		t.Errorf("\t%s\tGot the Backup of %q, want dbcluster-sample", failed, backup.Spec.DBClusterRef)
+	}
+	if _, err := alloyDB.getBackup("other", "backup1"); !apierrors.IsNotFound(err) {
+		t.Errorf("\t%s\tGot %v for a Backup of another namespace, want NotFound", failed, err)
+	}
+	backups, err := alloyDB.listBackups("db")
+	if err != nil {
+		t.Fatalf("\t%s\tCould not list the Backups:: %v", failed, err)
+	}
+	if len(backups) != 1 || backups[0].Name != "backup1" {
+		t.Errorf("\t%s\tGot the Backups %+v, want backup1", failed, backups)
+	}
+
+}
+
+// setTestAlloyDB makes alloyDB serve the AlloyDB resources, given as JSON, from a fake client.
+func setTestAlloyDB(t *testing.T, objects ...string) {
+
+	listKinds := map[schema.GroupVersionResource]string{
+		dbClusterResource:   "DBClusterList",
+		backupResource:      "BackupList",
+		replicationResource: "ReplicationList",
+		dbInstanceResource:  "DBInstanceList",
+		instanceResource:    "InstanceList",
+	}
+	objs := []runtime.Object{}
+	for _, o := range objects {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON([]byte(o)); err != nil {
+			t.Fatalf("\t%s\tInvalid test object %s:: %v", failed, o, err)
+		}
+		objs = append(objs, obj)
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objs...)
+	stop := make(chan struct{})
+	lister := newInformerLister(client, stop)
+	resources := []schema.GroupVersionResource{}
+	for gvr := range listKinds {
+		resources = append(resources, gvr)
+	}
+	if err := lister.watch(resources...); err != nil {
+		t.Fatalf("\t%s\tCould not watch the AlloyDB resources:: %v", failed, err)
+	}
+	saved := alloyDB
+	alloyDB = lister
+	t.Cleanup(func() {
+		close(stop)
+		alloyDB = saved
+	})
+
+}
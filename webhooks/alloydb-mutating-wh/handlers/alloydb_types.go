@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The parts of the AlloyDB Omni operator's alloydbomni.dbadmin.goog/v1 resources the validators look at, the fields
+// they don't need are left out & ignored when decoding.
+
+const alloyDBGroup = "alloydbomni.dbadmin.goog"
+
+var dbClusterKind = schema.GroupKind{Group: alloyDBGroup, Kind: "DBCluster"}
+
+type DBCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DBClusterSpec   `json:"spec,omitempty"`
+	Status DBClusterStatus `json:"status,omitempty"`
+}
+
+type DBClusterSpec struct {
+	DatabaseVersion string       `json:"databaseVersion,omitempty"`
+	Availability    Availability `json:"availability,omitempty"`
+	PrimarySpec     PrimarySpec  `json:"primarySpec,omitempty"`
+}
+
+type DBClusterStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// haReadyCondition is reported by the operator once the standbys are in sync & can take over from the primary.
+const haReadyCondition = "HAReady"
+
+type Availability struct {
+	NumberOfStandbys int32 `json:"numberOfStandbys,omitempty"`
+}
+
+type PrimarySpec struct {
+	Resources        Resources         `json:"resources,omitempty"`
+	SchedulingConfig *SchedulingConfig `json:"schedulingconfig,omitempty"`
+	Parameters       map[string]string `json:"parameters,omitempty"` // Postgres parameters
+}
+
+// SchedulingConfig is rendered by the operator into the pods of the DBCluster.
+type SchedulingConfig struct {
+	Tolerations  []corev1.Toleration  `json:"tolerations,omitempty"`
+	NodeAffinity *corev1.NodeAffinity `json:"nodeaffinity,omitempty"`
+}
+
+type Resources struct {
+	CPU    *resource.Quantity `json:"cpu,omitempty"`
+	Memory *resource.Quantity `json:"memory,omitempty"`
+	Disks  []Disk             `json:"disks,omitempty"`
+}
+
+type Disk struct {
+	Name         string            `json:"name"`
+	Size         resource.Quantity `json:"size"`
+	StorageClass string            `json:"storageClass,omitempty"`
+}
+
+var backupPlanKind = schema.GroupKind{Group: alloyDBGroup, Kind: "BackupPlan"}
+
+type BackupPlan struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BackupPlanSpec `json:"spec,omitempty"`
+}
+
+type BackupPlanSpec struct {
+	DBClusterRef     string          `json:"dbclusterRef,omitempty"`
+	BackupRetainDays *int64          `json:"backupRetainDays,omitempty"`
+	Paused           bool            `json:"paused,omitempty"`
+	BackupSchedules  BackupSchedules `json:"backupSchedules,omitempty"`
+	BackupLocation   *BackupLocation `json:"backupLocation,omitempty"`
+}
+
+// BackupSchedules are cron expressions.
+type BackupSchedules struct {
+	Full        string `json:"full,omitempty"`
+	Incremental string `json:"incremental,omitempty"`
+}
+
+type BackupLocation struct {
+	Type       string         `json:"type,omitempty"` // GCS or S3
+	GCSOptions *BucketOptions `json:"gcsOptions,omitempty"`
+	S3Options  *BucketOptions `json:"s3Options,omitempty"`
+}
+
+type BucketOptions struct {
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+var restoreKind = schema.GroupKind{Group: alloyDBGroup, Kind: "Restore"}
+
+var backupKind = schema.GroupKind{Group: alloyDBGroup, Kind: "Backup"}
+
+type Backup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BackupSpec   `json:"spec,omitempty"`
+	Status BackupStatus `json:"status,omitempty"`
+}
+
+type BackupSpec struct {
+	DBClusterRef  string `json:"dbclusterRef,omitempty"`
+	BackupPlanRef string `json:"backupPlanRef,omitempty"`
+	Manual        bool   `json:"manual,omitempty"`
+}
+
+type BackupStatus struct {
+	Phase        string       `json:"phase,omitempty"`
+	CompleteTime *metav1.Time `json:"completeTime,omitempty"`
+}
+
+// backupSucceededPhase is the phase of a Backup the operator completed.
+const backupSucceededPhase = "Succeeded"
+
+// Restore restores the source DBCluster in place or, with a ClonedDBClusterConfig, clones it into a new DBCluster.
+type Restore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec RestoreSpec `json:"spec,omitempty"`
+}
+
+type RestoreSpec struct {
+	SourceDBCluster       string                 `json:"sourceDBCluster,omitempty"`
+	Backup                string                 `json:"backup,omitempty"`
+	PointInTime           *metav1.Time           `json:"pointInTime,omitempty"`
+	ClonedDBClusterConfig *ClonedDBClusterConfig `json:"clonedDBClusterConfig,omitempty"`
+}
+
+type ClonedDBClusterConfig struct {
+	DBClusterName string `json:"dbclusterName,omitempty"`
+}
+
+var (
+	failoverKind   = schema.GroupKind{Group: alloyDBGroup, Kind: "Failover"}
+	switchoverKind = schema.GroupKind{Group: alloyDBGroup, Kind: "Switchover"}
+)
+
+// Failover promotes a standby of an unavailable primary.
+type Failover struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec FailoverSpec `json:"spec,omitempty"`
+}
+
+type FailoverSpec struct {
+	DBClusterRef string `json:"dbclusterRef,omitempty"`
+}
+
+// Switchover swaps a healthy primary with a standby, the operator picks the standby unless NewPrimary names it.
+type Switchover struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SwitchoverSpec `json:"spec,omitempty"`
+}
+
+type SwitchoverSpec struct {
+	DBClusterRef       string `json:"dbclusterRef,omitempty"`
+	NewPrimary         string `json:"newPrimary,omitempty"`
+	NewPrimaryInstance string `json:"newPrimaryInstance,omitempty"` // Deprecated by the operator for NewPrimary
+}
+
+// alloyDBInternalGroup holds the resources the operator manages the DBClusters with, a DBCluster's primary & standbys
+// are its Instances.
+const alloyDBInternalGroup = "alloydbomni.internal.dbadmin.goog"
+
+// Instance is a database instance of a DBCluster, labeled with its haRoleLabel.
+type Instance struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status InstanceStatus `json:"status,omitempty"`
+}
+
+type InstanceStatus struct {
+	Phase      string             `json:"phase,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// instanceReadyCondition is reported by the operator while the Instance is up & serving.
+const instanceReadyCondition = "Ready"
+
+var sidecarKind = schema.GroupKind{Group: alloyDBGroup, Kind: "Sidecar"}
+
+// Sidecar adds its containers & volumes to the database pods of the DBClusters annotated with its name.
+type Sidecar struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SidecarSpec `json:"spec,omitempty"`
+}
+
+type SidecarSpec struct {
+	Sidecars          []corev1.Container `json:"sidecars,omitempty"`
+	AdditionalVolumes []corev1.Volume    `json:"additionalVolumes,omitempty"`
+}
+
+var replicationKind = schema.GroupKind{Group: alloyDBGroup, Kind: "Replication"}
+
+// Replication makes its DBCluster the upstream other clusters replicate from or a downstream replicating from one,
+// depending on which of Upstream & Downstream is set.
+type Replication struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ReplicationSpec `json:"spec,omitempty"`
+}
+
+type ReplicationSpec struct {
+	DBCluster  corev1.LocalObjectReference `json:"dbcluster,omitempty"`
+	Upstream   *UpstreamReplication        `json:"upstream,omitempty"`
+	Downstream *DownstreamReplication      `json:"downstream,omitempty"`
+}
+
+type UpstreamReplication struct{}
+
+type DownstreamReplication struct {
+	Host                string                      `json:"host,omitempty"`
+	Port                int32                       `json:"port,omitempty"`
+	Username            string                      `json:"username,omitempty"`
+	Password            corev1.LocalObjectReference `json:"password,omitempty"`
+	ReplicationSlotName string                      `json:"replicationSlotName,omitempty"`
+	Control             string                      `json:"control,omitempty"`
+}
+
+var dbInstanceKind = schema.GroupKind{Group: alloyDBGroup, Kind: "DBInstance"}
+
+// readPoolInstanceType is the instanceType of the DBInstances serving reads from nodeCount replicas of their DBCluster.
+const readPoolInstanceType = "ReadPool"
+
+type DBInstance struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DBInstanceSpec `json:"spec,omitempty"`
+}
+
+type DBInstanceSpec struct {
+	InstanceType string                      `json:"instanceType,omitempty"`
+	DBCParent    corev1.LocalObjectReference `json:"dbcParent,omitempty"`
+	NodeCount    int32                       `json:"nodeCount,omitempty"`
+	Resources    Resources                   `json:"resources,omitempty"` // Of each node
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	log "k8s.io/klog/v2"
+)
+
+// AuditEvent is a line of the audit log, the decisions taken on the guarded operations & the patches of the dry-run
+// mutators as JSON apart from the logs.
+type AuditEvent struct {
+	Time      time.Time         `json:"time"`
+	Guard     string            `json:"guard"` // What took the decision, like deletion-protection or dry-run
+	Operation v1beta1.Operation `json:"operation"`
+	Kind      string            `json:"kind"`
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	User      string            `json:"user"`
+	Allowed   bool              `json:"allowed"`
+	Reason    string            `json:"reason"`
+}
+
+var (
+	auditMu  sync.Mutex
+	auditLog io.Writer = os.Stdout // The logs go to stderr
+)
+
+// BuildAuditLog appends the audit log to AUDIT_LOG_FILE when set rather than writing it to stdout.
+func BuildAuditLog() {
+	filePath := os.Getenv("AUDIT_LOG_FILE")
+	if filePath == "" {
+		return
+	}
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		configFailed("audit-log", "handlers.BuildAuditLog():Error opening the audit log file %s:: %v", filePath, err)
+		return
+	}
+	auditLog = file // Open for the lifetime of the webhook
+	log.Infof("handlers.BuildAuditLog():Writing the audit log to %s", filePath)
+
+}
+
+// audit writes the decision on the request to the audit log.
+func audit(req *validationRequest, guard, kind string, allowed bool, reason string) {
+
+	writeAuditEvent(AuditEvent{
+		Time:      now().UTC(),
+		Guard:     guard,
+		Operation: req.ar.Request.Operation,
+		Kind:      kind,
+		Namespace: req.namespace,
+		Name:      req.ar.Request.Name,
+		User:      req.ar.Request.UserInfo.Username,
+		Allowed:   allowed,
+		Reason:    reason,
+	})
+
+}
+
+func writeAuditEvent(event AuditEvent) {
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("handlers.writeAuditEvent():Could not write the audit event %+v:: %v", event, err)
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if _, err := auditLog.Write(append(line, '\n')); err != nil {
+		log.Errorf("handlers.writeAuditEvent():Could not write the audit event %s:: %v", line, err)
+	}
+
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+func TestAudit(t *testing.T) {
+
+	buf := setTestAuditLog(t)
+	req := &validationRequest{
+		ar: &v1beta1.AdmissionReview{Request: &v1beta1.AdmissionRequest{
+			Name:      "dbcluster-sample",
+			Namespace: "db",
+			Operation: v1beta1.Delete,
+			UserInfo:  authenticationv1.UserInfo{Username: "alice@example.com"},
+		}},
+		namespace: "db",
+	}
+	audit(req, "deletion-protection", "DBCluster", false, "protected")
+	audit(req, "deletion-protection", "DBCluster", true, "protected, deletion confirmed")
+
+	events := decodeTestAuditLog(t, buf)
+	want := AuditEvent{
+		Time:      time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		Guard:     "deletion-protection",
+		Operation: v1beta1.Delete,
+		Kind:      "DBCluster",
+		Namespace: "db",
+		Name:      "dbcluster-sample",
+		User:      "alice@example.com",
+		Allowed:   false,
+		Reason:    "protected",
+	}
+	if len(events) != 2 {
+		t.Fatalf("\t%s\tGot %d audit events, want 2:: %s", failed, len(events), buf)
+	}
+	if events[0] != want {
+		t.Errorf("\t%s\tGot the audit event %+v, want %+v", failed, events[0], want)
+	}
+	if !events[1].Allowed {
+		t.Errorf("\t%s\tGot the audit event %+v, want it allowed", failed, events[1])
+	}
+
+}
+
+// setTestAuditLog writes the audit log to the returned buffer at a fixed time.
+func setTestAuditLog(t *testing.T) *bytes.Buffer {
+
+	buf := &bytes.Buffer{}
+	savedLog, savedNow := auditLog, now
+	auditLog = buf
+	now = func() time.Time { return time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() {
+		auditLog, now = savedLog, savedNow
+	})
+	return buf
+
+}
+
+func decodeTestAuditLog(t *testing.T, buf *bytes.Buffer) []AuditEvent {
+
+	events := []AuditEvent{}
+	decoder := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for decoder.More() {
+		event := AuditEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatalf("\t%s\tInvalid audit log %s:: %v", failed, buf, err)
+		}
+		events = append(events, event)
+	}
+	return events
+
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// IntRange bounds an integer, a nil bound isn't checked.
+type IntRange struct {
+	Min *int64 `json:"min,omitempty"`
+	Max *int64 `json:"max,omitempty"`
+}
+
+// BackupLocationPolicy restricts where the backups go, an empty list allows anything.
+type BackupLocationPolicy struct {
+	Types          []string `json:"types,omitempty"`          // GCS or S3
+	BucketPrefixes []string `json:"bucketPrefixes,omitempty"` // The bucket must start with one of them
+}
+
+// BackupPlanPolicy is the layout of the file pointed to by BACKUPPLAN_POLICY_CONFIG_PATH & BACKUPPLAN_POLICY_CONFIG_FILE.
+type BackupPlanPolicy struct {
+	RetainDays IntRange `json:"retainDays,omitempty"`
+	// RequiredSchedules are the backupSchedules every plan must set, full or incremental.
+	RequiredSchedules []string `json:"requiredSchedules,omitempty"`
+	// Location applies to the namespaces without an entry in NamespaceLocations.
+	Location           BackupLocationPolicy            `json:"location,omitempty"`
+	NamespaceLocations map[string]BackupLocationPolicy `json:"namespaceLocations,omitempty"`
+}
+
+var backupLocationTypes = []string{"GCS", "S3"}
+
+var backupScheduleNames = []string{"full", "incremental"}
+
+var backupPlanPolicy *BackupPlanPolicy
+
+// BuildBackupPlanPolicy loads the BackupPlan policy & serves its validator at /validate/backupplan when
+// BACKUPPLAN_POLICY_CONFIG_FILE is set.
+func BuildBackupPlanPolicy() {
+	fileName := os.Getenv("BACKUPPLAN_POLICY_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("BACKUPPLAN_POLICY_CONFIG_PATH"), fileName)
+	registerValidator("/validate/backupplan", backupPlanKind, validateBackupPlan, "backupplan-policy")
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("backupplan-policy", "handlers.BuildBackupPlanPolicy():Error opening BackupPlan policy config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("backupplan-policy", "handlers.BuildBackupPlanPolicy():Error reading the BackupPlan policy from the file:: %v", err)
+		return
+	}
+	if backupPlanPolicy, err = loadBackupPlanPolicy(data); err != nil {
+		configFailed("backupplan-policy", "handlers.BuildBackupPlanPolicy():Error loading the BackupPlan policy from the file %s:: %v", filePath, err)
+		return
+	}
+	configLoaded("backupplan-policy", filePath, data)
+	log.Info("handlers.BuildBackupPlanPolicy():Enabled the BackupPlan policy validation")
+
+}
+
+func loadBackupPlanPolicy(data []byte) (*BackupPlanPolicy, error) {
+
+	policy := &BackupPlanPolicy{}
+	if err := loadConfig(data, policy, policy.validate); err != nil {
+		return nil, err
+	}
+	return policy, nil
+
+}
+
+func (p *BackupPlanPolicy) validate() field.ErrorList {
+
+	errs := field.ErrorList{}
+	retainPath := field.NewPath("retainDays")
+	if p.RetainDays.Min != nil && *p.RetainDays.Min < 1 {
+		errs = append(errs, field.Invalid(retainPath.Child("min"), *p.RetainDays.Min, "must be at least 1"))
+	}
+	if p.RetainDays.Min != nil && p.RetainDays.Max != nil && *p.RetainDays.Min > *p.RetainDays.Max {
+		errs = append(errs, field.Invalid(retainPath.Child("max"), *p.RetainDays.Max, fmt.Sprintf("must not be less than min %d", *p.RetainDays.Min)))
+	}
+	for i, name := range p.RequiredSchedules {
+		if !containsString(backupScheduleNames, name) {
+			errs = append(errs, field.NotSupported(field.NewPath("requiredSchedules").Index(i), name, backupScheduleNames))
+		}
+	}
+	errs = append(errs, p.Location.validate(field.NewPath("location"))...)
+	for ns, location := range p.NamespaceLocations {
+		errs = append(errs, location.validate(field.NewPath("namespaceLocations").Key(ns))...)
+	}
+	return errs
+
+}
+
+func (l BackupLocationPolicy) validate(fldPath *field.Path) field.ErrorList {
+
+	errs := field.ErrorList{}
+	for i, t := range l.Types {
+		if !containsString(backupLocationTypes, t) {
+			errs = append(errs, field.NotSupported(fldPath.Child("types").Index(i), t, backupLocationTypes))
+		}
+	}
+	for i, prefix := range l.BucketPrefixes {
+		if prefix == "" {
+			errs = append(errs, field.Required(fldPath.Child("bucketPrefixes").Index(i), "an empty prefix allows every bucket, leave the list empty instead"))
+		}
+	}
+	return errs
+
+}
+
+// location returns the location policy of the namespace.
+func (p *BackupPlanPolicy) location(namespace string) BackupLocationPolicy {
+	if l, ok := p.NamespaceLocations[namespace]; ok {
+		return l
+	}
+	return p.Location
+}
+
+// validateBackupPlan enforces backupPlanPolicy on the BackupPlans created or updated.
+func validateBackupPlan(req *validationRequest) (field.ErrorList, error) {
+
+	if req.ar.Request.Operation != v1beta1.Create && req.ar.Request.Operation != v1beta1.Update {
+		return nil, nil
+	}
+	plan := &BackupPlan{}
+	if err := json.Unmarshal(req.ar.Request.Object.Raw, plan); err != nil {
+		return nil, err
+	}
+	p := backupPlanPolicy
+	specPath := field.NewPath("spec")
+	errs := field.ErrorList{}
+
+	schedulesPath := specPath.Child("backupSchedules")
+	schedules := map[string]string{"full": plan.Spec.BackupSchedules.Full, "incremental": plan.Spec.BackupSchedules.Incremental}
+	for _, name := range backupScheduleNames {
+		schedule := schedules[name]
+		if schedule == "" {
+			if containsString(p.RequiredSchedules, name) {
+				errs = append(errs, field.Required(schedulesPath.Child(name), "the backup policy requires it"))
+			}
+			continue
+		}
+		if _, err := cron.ParseStandard(schedule); err != nil {
+			errs = append(errs, field.Invalid(schedulesPath.Child(name), schedule, fmt.Sprintf("must be a cron expression of 5 fields or a descriptor like @daily: %v", err)))
+		}
+	}
+
+	retainPath := specPath.Child("backupRetainDays")
+	if retain := plan.Spec.BackupRetainDays; retain == nil {
+		if p.RetainDays.Min != nil || p.RetainDays.Max != nil {
+			errs = append(errs, field.Required(retainPath, "the backup policy bounds it"))
+		}
+	} else if p.RetainDays.Min != nil && *retain < *p.RetainDays.Min {
+		errs = append(errs, field.Invalid(retainPath, *retain, fmt.Sprintf("must be at least %d days", *p.RetainDays.Min)))
+	} else if p.RetainDays.Max != nil && *retain > *p.RetainDays.Max {
+		errs = append(errs, field.Invalid(retainPath, *retain, fmt.Sprintf("must be at most %d days", *p.RetainDays.Max)))
+	}
+
+	errs = append(errs, checkBackupLocation(plan.Spec.BackupLocation, p.location(req.namespace), req.namespace, specPath.Child("backupLocation"))...)
+	return errs, nil
+
+}
+
+func checkBackupLocation(location *BackupLocation, policy BackupLocationPolicy, namespace string, fldPath *field.Path) field.ErrorList {
+
+	if location == nil {
+		if len(policy.Types) != 0 {
+			return field.ErrorList{field.Required(fldPath, fmt.Sprintf("the backups of the namespace %s must go to %s", namespace, strings.Join(policy.Types, " or ")))}
+		}
+		return nil
+	}
+	if len(policy.Types) != 0 && !containsString(policy.Types, location.Type) {
+		return field.ErrorList{field.NotSupported(fldPath.Child("type"), location.Type, policy.Types)}
+	}
+	var options *BucketOptions
+	optionsPath := fldPath.Child("gcsOptions")
+	switch location.Type {
+	case "GCS":
+		options = location.GCSOptions
+	case "S3":
+		options, optionsPath = location.S3Options, fldPath.Child("s3Options")
+	default:
+		return nil // Left to the operator
+	}
+	if len(policy.BucketPrefixes) == 0 {
+		return nil
+	}
+	if options == nil || options.Bucket == "" {
+		return field.ErrorList{field.Required(optionsPath.Child("bucket"), "")}
+	}
+	for _, prefix := range policy.BucketPrefixes {
+		if strings.HasPrefix(options.Bucket, prefix) {
+			return nil
+		}
+	}
+	return field.ErrorList{field.Invalid(optionsPath.Child("bucket"), options.Bucket,
+		fmt.Sprintf("the backups of the namespace %s must go to a bucket starting with %s", namespace, strings.Join(policy.BucketPrefixes, ", ")))}
+
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestValidateBackupPlan(t *testing.T) {
+	tests := []struct {
+		id         int
+		name       string
+		namespace  string
+		object     string
+		allowed    bool
+		wantFields []string
+	}{
+		{
+			name:      "Compliant GCS Plan",
+			id:        0,
+			namespace: "db",
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "BackupPlan", "metadata": {"name": "backupplan1"}, "spec": {"dbclusterRef": "dbcluster-sample", "backupRetainDays": 14, "backupSchedules": {"full": "0 0 * * 0", "incremental": "0 21 * * *"}, "backupLocation": {"type": "GCS", "gcsOptions": {"bucket": "db-team-backups", "key": "/backup"}}}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Typo In The Schedule",
+			id:         1,
+			namespace:  "db",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "BackupPlan", "metadata": {"name": "backupplan1"}, "spec": {"backupRetainDays": 14, "backupSchedules": {"full": "0 0 * * 0", "incremental": "0 21 * *"}, "backupLocation": {"type": "GCS", "gcsOptions": {"bucket": "db-team-backups"}}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.backupSchedules.incremental"},
+		},
+		{
+			name:       "Retention Out Of Bounds And No Full Backup",
+			id:         2,
+			namespace:  "db",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "BackupPlan", "metadata": {"name": "backupplan1"}, "spec": {"backupRetainDays": 400, "backupSchedules": {"incremental": "@daily"}, "backupLocation": {"type": "GCS", "gcsOptions": {"bucket": "db-team-backups"}}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.backupSchedules.full", "spec.backupRetainDays"},
+		},
+		{
+			name:       "Bucket Of Another Team",
+			id:         3,
+			namespace:  "db",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "BackupPlan", "metadata": {"name": "backupplan1"}, "spec": {"backupRetainDays": 14, "backupSchedules": {"full": "0 0 * * 0"}, "backupLocation": {"type": "GCS", "gcsOptions": {"bucket": "payments-backups"}}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.backupLocation.gcsOptions.bucket"},
+		},
+		{
+			name:       "Location Type Not Allowed In The Namespace",
+			id:         4,
+			namespace:  "db",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "BackupPlan", "metadata": {"name": "backupplan1"}, "spec": {"backupRetainDays": 14, "backupSchedules": {"full": "0 0 * * 0"}, "backupLocation": {"type": "S3", "s3Options": {"bucket": "db-team-backups"}}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.backupLocation.type"},
+		},
+		{
+			name:      "Default Location Policy",
+			id:        5,
+			namespace: "analytics",
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "BackupPlan", "metadata": {"name": "backupplan1"}, "spec": {"backupRetainDays": 7, "backupSchedules": {"full": "0 0 * * 0"}, "backupLocation": {"type": "S3", "s3Options": {"bucket": "org-backups-analytics"}}}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Local Backups",
+			id:         6,
+			namespace:  "analytics",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "BackupPlan", "metadata": {"name": "backupplan1"}, "spec": {"backupRetainDays": 7, "backupSchedules": {"full": "0 0 * * 0"}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.backupLocation"},
+		},
+	}
+
+	setTestBackupPlanPolicy(t)
+	admit := validatingRoutes["/validate/backupplan"]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      "backupplan1",
+					Namespace: tt.namespace,
+					Operation: v1beta1.Create,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+				},
+			}
+			got := admit(ar, nil)
+
+			if got.Allowed != tt.allowed {
+				t.Fatalf("\t%s\tTest ID=%d::Got allowed %t, want %t:: %+v", failed, tt.id, got.Allowed, tt.allowed, got.Result)
+			}
+			if tt.allowed {
+				return
+			}
+			fields := []string{}
+			for _, cause := range got.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %s", failed, tt.id, fields, tt.wantFields, got.Result.Message)
+			}
+		})
+	}
+}
+
+// setTestBackupPlanPolicy keeps the backups of the db namespace in its own GCS buckets & the others in org S3 or GCS buckets.
+func setTestBackupPlanPolicy(t *testing.T) {
+
+	policy, err := loadBackupPlanPolicy([]byte(`
+retainDays: {min: 7, max: 35}
+requiredSchedules: [full]
+location:
+  types: [GCS, S3]
+  bucketPrefixes: [org-backups-]
+namespaceLocations:
+  db:
+    types: [GCS]
+    bucketPrefixes: [db-team-]
+`))
+	if err != nil {
+		t.Fatalf("\t%s\tCould not load the BackupPlan policy:: %v", failed, err)
+	}
+	savedPolicy, savedRoute := backupPlanPolicy, validatingRoutes["/validate/backupplan"]
+	backupPlanPolicy = policy
+	registerValidator("/validate/backupplan", backupPlanKind, validateBackupPlan)
+	t.Cleanup(func() {
+		backupPlanPolicy = savedPolicy
+		if savedRoute == nil {
+			delete(validatingRoutes, "/validate/backupplan")
+		} else {
+			validatingRoutes["/validate/backupplan"] = savedRoute
+		}
+	})
+}
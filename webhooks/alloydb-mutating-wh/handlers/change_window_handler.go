@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// ChangeWindow is a daily time range, End before Start runs past midnight & Days are the days it starts on.
+type ChangeWindow struct {
+	Days     []string `json:"days,omitempty"` // Mon to Sun, every day when empty
+	Start    string   `json:"start"`          // 15:04
+	End      string   `json:"end"`            // 15:04
+	TimeZone string   `json:"timeZone,omitempty"`
+
+	start, end time.Duration
+	location   *time.Location
+}
+
+// ChangeWindows is the layout of the file pointed to by CHANGE_WINDOWS_CONFIG_PATH & CHANGE_WINDOWS_CONFIG_FILE, the
+// Failovers & Switchovers of a namespace without any window aren't restricted.
+type ChangeWindows struct {
+	// Windows apply to the namespaces without an entry in NamespaceWindows.
+	Windows          []ChangeWindow            `json:"windows,omitempty"`
+	NamespaceWindows map[string][]ChangeWindow `json:"namespaceWindows,omitempty"`
+}
+
+var weekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+var changeWindows *ChangeWindows
+
+var now = time.Now // Replaced by the tests
+
+// BuildChangeWindows loads the change windows & serves the Failover & Switchover validators at /validate/failover &
+// /validate/switchover when CHANGE_WINDOWS_CONFIG_FILE is set.
+func BuildChangeWindows() {
+	fileName := os.Getenv("CHANGE_WINDOWS_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("CHANGE_WINDOWS_CONFIG_PATH"), fileName)
+	registerValidator("/validate/failover", failoverKind, validateFailover, "change-windows", "alloydb")
+	registerValidator("/validate/switchover", switchoverKind, validateSwitchover, "change-windows", "alloydb")
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("change-windows", "handlers.BuildChangeWindows():Error opening change windows config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("change-windows", "handlers.BuildChangeWindows():Error reading the change windows from the file:: %v", err)
+		return
+	}
+	if changeWindows, err = loadChangeWindows(data); err != nil {
+		configFailed("change-windows", "handlers.BuildChangeWindows():Error loading the change windows from the file %s:: %v", filePath, err)
+		return
+	}
+	configLoaded("change-windows", filePath, data)
+	watchAlloyDB(dbClusterResource, instanceResource)
+	log.Info("handlers.BuildChangeWindows():Enabled the Failover & Switchover validation")
+
+}
+
+func loadChangeWindows(data []byte) (*ChangeWindows, error) {
+
+	windows := &ChangeWindows{}
+	if err := loadConfig(data, windows, windows.validate); err != nil {
+		return nil, err
+	}
+	return windows, nil
+
+}
+
+// validate checks & parses the windows.
+func (c *ChangeWindows) validate() field.ErrorList {
+
+	errs := field.ErrorList{}
+	for i := range c.Windows {
+		errs = append(errs, c.Windows[i].validate(field.NewPath("windows").Index(i))...)
+	}
+	for ns, windows := range c.NamespaceWindows {
+		for i := range windows {
+			errs = append(errs, windows[i].validate(field.NewPath("namespaceWindows").Key(ns).Index(i))...)
+		}
+	}
+	return errs
+
+}
+
+func (w *ChangeWindow) validate(fldPath *field.Path) field.ErrorList {
+
+	errs := field.ErrorList{}
+	for i, day := range w.Days {
+		if !containsString(weekdays, day) {
+			errs = append(errs, field.NotSupported(fldPath.Child("days").Index(i), day, weekdays))
+		}
+	}
+	var err error
+	if w.start, err = parseTimeOfDay(w.Start); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("start"), w.Start, err.Error()))
+	}
+	if w.end, err = parseTimeOfDay(w.End); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("end"), w.End, err.Error()))
+	}
+	if w.location, err = time.LoadLocation(w.TimeZone); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("timeZone"), w.TimeZone, err.Error()))
+	}
+	return errs
+
+}
+
+// parseTimeOfDay returns the time since midnight of a 15:04 time.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("must be a time of day like 22:30")
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains tells if t falls in the window, a window running past midnight is checked against the previous day too.
+func (w *ChangeWindow) contains(t time.Time) bool {
+
+	t = t.In(w.location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, w.location)
+	for _, day := range []time.Time{midnight, midnight.AddDate(0, 0, -1)} {
+		if len(w.Days) != 0 && !containsString(w.Days, weekdays[day.Weekday()]) {
+			continue
+		}
+		start, end := day.Add(w.start), day.Add(w.end)
+		if w.end <= w.start {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+
+}
+
+func (w *ChangeWindow) String() string {
+	days := "every day"
+	if len(w.Days) != 0 {
+		days = strings.Join(w.Days, ",")
+	}
+	return fmt.Sprintf("%s %s-%s %s", days, w.Start, w.End, w.location)
+}
+
+// windows returns the change windows of the namespace.
+func (c *ChangeWindows) windows(namespace string) []ChangeWindow {
+	if w, ok := c.NamespaceWindows[namespace]; ok {
+		return w
+	}
+	return c.Windows
+}
+
+// validateFailover denies the Failovers created outside the change windows of their namespace without break-glass.
+func validateFailover(req *validationRequest) (field.ErrorList, error) {
+
+	if req.ar.Request.Operation != v1beta1.Create {
+		return nil, nil
+	}
+	failover := &Failover{}
+	if err := json.Unmarshal(req.ar.Request.Object.Raw, failover); err != nil {
+		return nil, err
+	}
+	return checkChangeWindow(req, failoverKind.Kind, failover.ObjectMeta), nil
+
+}
+
+// validateSwitchover denies the Switchovers created outside the change windows of their namespace without break-glass,
+// the ones of a DBCluster whose standbys aren't reported ready to take over & the ones naming a newPrimary, or the
+// deprecated newPrimaryInstance, that isn't a healthy standby.
+func validateSwitchover(req *validationRequest) (field.ErrorList, error) {
+
+	if req.ar.Request.Operation != v1beta1.Create {
+		return nil, nil
+	}
+	switchover := &Switchover{}
+	if err := json.Unmarshal(req.ar.Request.Object.Raw, switchover); err != nil {
+		return nil, err
+	}
+	errs := checkChangeWindow(req, switchoverKind.Kind, switchover.ObjectMeta)
+
+	refPath := field.NewPath("spec", "dbclusterRef")
+	name := switchover.Spec.DBClusterRef
+	if name == "" {
+		return append(errs, field.Required(refPath, "")), nil
+	}
+	cluster, err := alloyDB.getDBCluster(req.namespace, name)
+	if apierrors.IsNotFound(err) {
+		return append(errs, field.NotFound(refPath, name)), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not look up the DBCluster %s: %v", name, err)
+	}
+	if condition := meta.FindStatusCondition(cluster.Status.Conditions, haReadyCondition); condition == nil || condition.Status != metav1.ConditionTrue {
+		reason := "the DBCluster doesn't report it"
+		if condition != nil {
+			reason = fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		}
+		errs = append(errs, field.Invalid(refPath, name, fmt.Sprintf("the standby of the DBCluster isn't ready to take over, %s is not True (%s)", haReadyCondition, reason)))
+	}
+
+	target, targetPath := switchover.Spec.NewPrimary, field.NewPath("spec", "newPrimary")
+	if target == "" {
+		target, targetPath = switchover.Spec.NewPrimaryInstance, field.NewPath("spec", "newPrimaryInstance")
+	}
+	if target == "" {
+		return errs, nil
+	}
+	instance, err := alloyDB.getInstance(req.namespace, target)
+	if apierrors.IsNotFound(err) {
+		return append(errs, field.NotFound(targetPath, target)), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not look up the Instance %s: %v", target, err)
+	}
+	if role := instance.Labels[haRoleLabel]; role != "Standby" {
+		return append(errs, field.Invalid(targetPath, target, fmt.Sprintf("is not a standby, its %s label is %q", haRoleLabel, role))), nil
+	}
+	if condition := meta.FindStatusCondition(instance.Status.Conditions, instanceReadyCondition); condition == nil || condition.Status != metav1.ConditionTrue {
+		reason := fmt.Sprintf("the Instance doesn't report it, phase %q", instance.Status.Phase)
+		if condition != nil {
+			reason = fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		}
+		errs = append(errs, field.Invalid(targetPath, target, fmt.Sprintf("the standby isn't healthy, %s is not True (%s)", instanceReadyCondition, reason)))
+	}
+	return errs, nil
+
+}
+
+// checkChangeWindow returns an error unless the operation is in a change window or sets breakGlassAnnotation to the
+// reason. The reason is only attested by the requester, the override is logged & goes to the audit log.
+func checkChangeWindow(req *validationRequest, kind string, obj metav1.ObjectMeta) field.ErrorList {
+
+	windows := changeWindows.windows(req.namespace)
+	if len(windows) == 0 {
+		return nil
+	}
+	t := now()
+	for i := range windows {
+		if windows[i].contains(t) {
+			return nil
+		}
+	}
+	if reason := strings.TrimSpace(obj.Annotations[breakGlassAnnotation]); reason != "" {
+		log.Warningf("handlers.checkChangeWindow():Break-glass %s %s/%s by %s outside the change windows:: %s",
+			kind, req.namespace, obj.Name, req.ar.Request.UserInfo.Username, reason)
+		req.warn("%s outside the change windows of the namespace %s with %s: %s", kind, req.namespace, breakGlassAnnotation, reason)
+		audit(req, "change-windows", kind, true, fmt.Sprintf("%s: %s", breakGlassAnnotation, reason))
+		return nil
+	}
+	allowed := []string{}
+	for i := range windows {
+		allowed = append(allowed, windows[i].String())
+	}
+	reason := fmt.Sprintf("a %s in the namespace %s outside its change windows (%s) needs the annotation %s set to the reason", kind, req.namespace, strings.Join(allowed, "; "), breakGlassAnnotation)
+	audit(req, "change-windows", kind, false, reason)
+	return field.ErrorList{field.Forbidden(field.NewPath("metadata", "annotations").Key(breakGlassAnnotation), reason)}
+
+}
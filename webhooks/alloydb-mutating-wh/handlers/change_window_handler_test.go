@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestLoadChangeWindows(t *testing.T) {
+	tests := []struct {
+		id      int
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:   "Valid Windows",
+			id:     0,
+			config: "windows:\n- days: [Sat, Sun]\n  start: \"22:00\"\n  end: \"04:00\"\n  timeZone: America/New_York\nnamespaceWindows:\n  sandbox: []\n",
+		},
+		{
+			name:    "Unknown Day",
+			id:      1,
+			config:  "windows:\n- days: [Saturday]\n  start: \"22:00\"\n  end: \"04:00\"\n",
+			wantErr: "windows[0].days[0]",
+		},
+		{
+			name:    "Invalid Time Of Day",
+			id:      2,
+			config:  "windows:\n- start: \"10pm\"\n  end: \"04:00\"\n",
+			wantErr: "windows[0].start",
+		},
+		{
+			name:    "Unknown Time Zone",
+			id:      3,
+			config:  "namespaceWindows:\n  payments:\n  - start: \"22:00\"\n    end: \"04:00\"\n    timeZone: Mars/Olympus\n",
+			wantErr: "namespaceWindows[payments][0].timeZone",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadChangeWindows([]byte(tt.config))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("\t%s\tTest ID=%d::Could not load the change windows:: %v", failed, tt.id, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("\t%s\tTest ID=%d::Got the error %v, want one about %s", failed, tt.id, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFailoverAndSwitchover(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("\t%s\tCould not load the time zone:: %v", failed, err)
+	}
+	tests := []struct {
+		id           int
+		name         string
+		path         string
+		namespace    string
+		now          time.Time
+		object       string
+		allowed      bool
+		wantFields   []string
+		wantWarnings int
+		wantAudited  bool // Outside the change windows
+	}{
+		{
+			name:      "Failover In The Saturday Window",
+			id:        0,
+			path:      "/validate/failover",
+			namespace: "db",
+			now:       time.Date(2026, 10, 17, 23, 30, 0, 0, newYork),
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Failover", "metadata": {"name": "failover-sample"}, "spec": {"dbclusterRef": "ha-ready"}}`,
+			allowed:   true,
+		},
+		{
+			name:      "Failover In The Sunday Window Past Midnight",
+			id:        1,
+			path:      "/validate/failover",
+			namespace: "db",
+			now:       time.Date(2026, 10, 19, 2, 0, 0, 0, newYork),
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Failover", "metadata": {"name": "failover-sample"}, "spec": {"dbclusterRef": "ha-ready"}}`,
+			allowed:   true,
+		},
+		{
+			name:        "Failover On A Weekday",
+			id:          2,
+			path:        "/validate/failover",
+			namespace:   "db",
+			now:         time.Date(2026, 10, 19, 10, 0, 0, 0, newYork),
+			object:      `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Failover", "metadata": {"name": "failover-sample"}, "spec": {"dbclusterRef": "ha-ready"}}`,
+			allowed:     false,
+			wantFields:  []string{"metadata.annotations[alloydb.cloud.google.com/break-glass]"},
+			wantAudited: true,
+		},
+		{
+			name:         "Break-Glass Failover On A Weekday",
+			id:           3,
+			path:         "/validate/failover",
+			namespace:    "db",
+			now:          time.Date(2026, 10, 16, 23, 0, 0, 0, newYork),
+			object:       `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Failover", "metadata": {"name": "failover-sample", "annotations": {"alloydb.cloud.google.com/break-glass": "CHG-42 primary node failing"}}, "spec": {"dbclusterRef": "ha-ready"}}`,
+			allowed:      true,
+			wantWarnings: 1,
+			wantAudited:  true,
+		},
+		{
+			name:      "Namespace Without Windows",
+			id:        4,
+			path:      "/validate/failover",
+			namespace: "sandbox",
+			now:       time.Date(2026, 10, 19, 10, 0, 0, 0, newYork),
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Failover", "metadata": {"name": "failover-sample"}, "spec": {"dbclusterRef": "ha-ready"}}`,
+			allowed:   true,
+		},
+		{
+			name:      "Switchover Of A Ready Cluster",
+			id:        5,
+			path:      "/validate/switchover",
+			namespace: "db",
+			now:       time.Date(2026, 10, 17, 23, 30, 0, 0, newYork),
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Switchover", "metadata": {"name": "switchover-sample"}, "spec": {"dbclusterRef": "ha-ready"}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Switchover Of A Cluster With A Lagging Standby",
+			id:         6,
+			path:       "/validate/switchover",
+			namespace:  "db",
+			now:        time.Date(2026, 10, 17, 23, 30, 0, 0, newYork),
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Switchover", "metadata": {"name": "switchover-sample"}, "spec": {"dbclusterRef": "lagging"}}`,
+			allowed:    false,
+			wantFields: []string{"spec.dbclusterRef"},
+		},
+		{
+			name:       "Switchover Of A Cluster Without Status",
+			id:         7,
+			path:       "/validate/switchover",
+			namespace:  "db",
+			now:        time.Date(2026, 10, 17, 23, 30, 0, 0, newYork),
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Switchover", "metadata": {"name": "switchover-sample"}, "spec": {"dbclusterRef": "new"}}`,
+			allowed:    false,
+			wantFields: []string{"spec.dbclusterRef"},
+		},
+		{
+			name:        "Switchover Of A Missing Cluster On A Weekday",
+			id:          8,
+			path:        "/validate/switchover",
+			namespace:   "db",
+			now:         time.Date(2026, 10, 19, 10, 0, 0, 0, newYork),
+			object:      `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Switchover", "metadata": {"name": "switchover-sample"}, "spec": {"dbclusterRef": "dbcluster-sample"}}`,
+			allowed:     false,
+			wantFields:  []string{"metadata.annotations[alloydb.cloud.google.com/break-glass]", "spec.dbclusterRef"},
+			wantAudited: true,
+		},
+		{
+			name:        "Blank Break-Glass Failover On A Weekday",
+			id:          9,
+			path:        "/validate/failover",
+			namespace:   "db",
+			now:         time.Date(2026, 10, 16, 23, 0, 0, 0, newYork),
+			object:      `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Failover", "metadata": {"name": "failover-sample", "annotations": {"alloydb.cloud.google.com/break-glass": " "}}, "spec": {"dbclusterRef": "ha-ready"}}`,
+			allowed:     false,
+			wantFields:  []string{"metadata.annotations[alloydb.cloud.google.com/break-glass]"},
+			wantAudited: true,
+		},
+		{
+			name:       "Switchover To An Unhealthy newPrimary Over The Deprecated Field",
+			id:         10,
+			path:       "/validate/switchover",
+			namespace:  "db",
+			now:        time.Date(2026, 10, 17, 23, 30, 0, 0, newYork),
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Switchover", "metadata": {"name": "switchover-sample"}, "spec": {"dbclusterRef": "ha-ready", "newPrimary": "ha-ready-standby-2", "newPrimaryInstance": "ha-ready-standby-1"}}`,
+			allowed:    false,
+			wantFields: []string{"spec.newPrimary"},
+		},
+		{
+			name:      "Switchover To A Healthy Standby",
+			id:        11,
+			path:      "/validate/switchover",
+			namespace: "db",
+			now:       time.Date(2026, 10, 17, 23, 30, 0, 0, newYork),
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Switchover", "metadata": {"name": "switchover-sample"}, "spec": {"dbclusterRef": "ha-ready", "newPrimaryInstance": "ha-ready-standby-1"}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Switchover To An Unhealthy Standby",
+			id:         12,
+			path:       "/validate/switchover",
+			namespace:  "db",
+			now:        time.Date(2026, 10, 17, 23, 30, 0, 0, newYork),
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Switchover", "metadata": {"name": "switchover-sample"}, "spec": {"dbclusterRef": "ha-ready", "newPrimary": "ha-ready-standby-2"}}`,
+			allowed:    false,
+			wantFields: []string{"spec.newPrimary"},
+		},
+		{
+			name:       "Switchover To The Primary",
+			id:         13,
+			path:       "/validate/switchover",
+			namespace:  "db",
+			now:        time.Date(2026, 10, 17, 23, 30, 0, 0, newYork),
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Switchover", "metadata": {"name": "switchover-sample"}, "spec": {"dbclusterRef": "ha-ready", "newPrimary": "ha-ready-primary"}}`,
+			allowed:    false,
+			wantFields: []string{"spec.newPrimary"},
+		},
+		{
+			name:       "Switchover To A Missing Instance",
+			id:         14,
+			path:       "/validate/switchover",
+			namespace:  "db",
+			now:        time.Date(2026, 10, 17, 23, 30, 0, 0, newYork),
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Switchover", "metadata": {"name": "switchover-sample"}, "spec": {"dbclusterRef": "ha-ready", "newPrimaryInstance": "ha-ready-standby-3"}}`,
+			allowed:    false,
+			wantFields: []string{"spec.newPrimaryInstance"},
+		},
+	}
+
+	buf := setTestAuditLog(t)
+	setTestChangeWindows(t)
+	savedNow := now
+	t.Cleanup(func() { now = savedNow })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = func() time.Time { return tt.now }
+			buf.Reset()
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      "failover-sample",
+					Namespace: tt.namespace,
+					Operation: v1beta1.Create,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+					UserInfo:  authenticationv1.UserInfo{Username: "alice"},
+				},
+			}
+			got := validatingRoutes[tt.path](ar, nil)
+
+			if got.Allowed != tt.allowed {
+				t.Fatalf("\t%s\tTest ID=%d::Got allowed %t, want %t:: %+v", failed, tt.id, got.Allowed, tt.allowed, got.Result)
+			}
+			if len(got.Warnings) != tt.wantWarnings {
+				t.Errorf("\t%s\tTest ID=%d::Got the warnings %v, want %d", failed, tt.id, got.Warnings, tt.wantWarnings)
+			}
+			if events := decodeTestAuditLog(t, buf); tt.wantAudited != (len(events) == 1 && events[0].Allowed == tt.allowed) {
+				t.Errorf("\t%s\tTest ID=%d::Got the audit events %+v, want audited %t", failed, tt.id, events, tt.wantAudited)
+			}
+			if tt.allowed {
+				return
+			}
+			fields := []string{}
+			for _, cause := range got.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %s", failed, tt.id, fields, tt.wantFields, got.Result.Message)
+			}
+		})
+	}
+}
+
+// setTestChangeWindows allows the Failovers & Switchovers from Saturday & Sunday 22:00 to 04:00 in New York, except in
+// the sandbox namespace where they're always allowed. The db namespace has a DBCluster ready for a switchover with a
+// healthy & an unhealthy standby, one with a lagging standby & a new one without any status.
+func setTestChangeWindows(t *testing.T) {
+
+	windows, err := loadChangeWindows([]byte(`
+windows:
+- days: [Sat, Sun]
+  start: "22:00"
+  end: "04:00"
+  timeZone: America/New_York
+namespaceWindows:
+  sandbox: []
+`))
+	if err != nil {
+		t.Fatalf("\t%s\tCould not load the change windows:: %v", failed, err)
+	}
+	setTestAlloyDB(t,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "ha-ready"}, "status": {"conditions": [{"type": "HAReady", "status": "True", "reason": "Ready", "message": "", "lastTransitionTime": "2026-10-01T00:00:00Z"}]}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "lagging"}, "status": {"conditions": [{"type": "HAReady", "status": "False", "reason": "StandbyLagging", "message": "replay lag 5m", "lastTransitionTime": "2026-10-01T00:00:00Z"}]}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "new"}}`,
+		`{"apiVersion": "alloydbomni.internal.dbadmin.goog/v1", "kind": "Instance", "metadata": {"namespace": "db", "name": "ha-ready-primary", "labels": {"dbs.internal.dbadmin.goog/ha-role": "Primary"}}, "status": {"phase": "Ready", "conditions": [{"type": "Ready", "status": "True", "reason": "Ready", "message": "", "lastTransitionTime": "2026-10-01T00:00:00Z"}]}}`,
+		`{"apiVersion": "alloydbomni.internal.dbadmin.goog/v1", "kind": "Instance", "metadata": {"namespace": "db", "name": "ha-ready-standby-1", "labels": {"dbs.internal.dbadmin.goog/ha-role": "Standby"}}, "status": {"phase": "Ready", "conditions": [{"type": "Ready", "status": "True", "reason": "Ready", "message": "", "lastTransitionTime": "2026-10-01T00:00:00Z"}]}}`,
+		`{"apiVersion": "alloydbomni.internal.dbadmin.goog/v1", "kind": "Instance", "metadata": {"namespace": "db", "name": "ha-ready-standby-2", "labels": {"dbs.internal.dbadmin.goog/ha-role": "Standby"}}, "status": {"phase": "Failed", "conditions": [{"type": "Ready", "status": "False", "reason": "DatabaseDown", "message": "postgres is not running", "lastTransitionTime": "2026-10-01T00:00:00Z"}]}}`,
+	)
+	saved, savedFailover, savedSwitchover := changeWindows, validatingRoutes["/validate/failover"], validatingRoutes["/validate/switchover"]
+	changeWindows = windows
+	registerValidator("/validate/failover", failoverKind, validateFailover)
+	registerValidator("/validate/switchover", switchoverKind, validateSwitchover)
+	t.Cleanup(func() {
+		changeWindows = saved
+		for path, route := range map[string]AdmitFunc{"/validate/failover": savedFailover, "/validate/switchover": savedSwitchover} {
+			if route == nil {
+				delete(validatingRoutes, path)
+			} else {
+				validatingRoutes[path] = route
+			}
+		}
+	})
+
+}
@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// configError is an error in a config file along with where it was found, the position is 0 when unknown.
+type configError struct {
+	line   int
+	column int
+	msg    string
+}
+
+func (e configError) Error() string {
+	if e.line == 0 {
+		return e.msg
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.line, e.column, e.msg)
+}
+
+var unknownFieldError = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+// loadConfig decodes the YAML or JSON config into out, refusing the fields out doesn't have, & then checks it with
+// validate. Every error found is returned at once with its line & column in the file.
+func loadConfig(data []byte, out interface{}, validate func() field.ErrorList) error {
+
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(data, root); err != nil {
+		return configError{msg: err.Error()} // Already tells the line
+	}
+	doc, err := sigsyaml.YAMLToJSON(data)
+	if err != nil {
+		return configError{msg: err.Error()}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		return decodeError(root, out, err)
+	}
+	if validate == nil {
+		return nil
+	}
+	errs := []error{}
+	for _, fieldErr := range validate() {
+		line, column := position(root, fieldErr.Field)
+		errs = append(errs, configError{line: line, column: column, msg: fieldErr.Error()})
+	}
+	return errors.Join(errs...)
+
+}
+
+// decodeError finds the field the JSON decoder choked on in the YAML nodes, which still know their position. A type
+// error tells the path of the field, an unknown field only its name so it's looked for along the type of out.
+func decodeError(root *yaml.Node, out interface{}, err error) error {
+
+	var typeErr *json.UnmarshalTypeError
+	var node *yaml.Node
+	if m := unknownFieldError.FindStringSubmatch(err.Error()); m != nil {
+		node = unknownKey(root, reflect.TypeOf(out), m[1])
+	} else if errors.As(err, &typeErr) && typeErr.Field != "" {
+		node = decodedField(root, typeErr.Field)
+	}
+	if node != nil {
+		return configError{line: node.Line, column: node.Column, msg: err.Error()}
+	}
+	return configError{msg: err.Error()}
+
+}
+
+var pathUnescaper = strings.NewReplacer("~1", "/", "~0", "~") // The decoder escapes the keys like a JSON pointer
+
+// decodedField follows a path like rules.0.tolerations.1.tolerationSeconds as the JSON decoder reports it through the
+// YAML nodes & returns the deepest one it could reach. The keys of a map may hold dots, the longest one matching wins.
+func decodedField(root *yaml.Node, path string) *yaml.Node {
+
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) != 0 {
+		node = node.Content[0]
+	}
+	var found *yaml.Node
+	segments := strings.Split(strings.TrimPrefix(path, "."), ".") // The path of a list at the root starts with a dot
+	for len(segments) != 0 {
+		var next *yaml.Node
+		n := 1
+		switch node.Kind {
+		case yaml.MappingNode:
+			n = 0
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				for k := len(segments); k > n; k-- {
+					if node.Content[i].Value == pathUnescaper.Replace(strings.Join(segments[:k], ".")) {
+						found, next, n = node.Content[i], node.Content[i+1], k
+						break
+					}
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(segments[0]); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+				found = next
+			}
+		}
+		if next == nil {
+			break
+		}
+		node, segments = next, segments[n:]
+	}
+	return found
+
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownKey walks the YAML nodes along the Go type they're decoded into & returns the first key named name that the
+// type has no field for, the same key may well be known elsewhere in the file.
+func unknownKey(node *yaml.Node, t reflect.Type, name string) *yaml.Node {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.DocumentNode {
+		for _, child := range node.Content {
+			if found := unknownKey(child, t, name); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) { // Decodes itself, like a quantity
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			fieldType, ok := jsonField(t, node.Content[i].Value)
+			if !ok {
+				if node.Content[i].Value == name {
+					return node.Content[i]
+				}
+				continue
+			}
+			if found := unknownKey(node.Content[i+1], fieldType, name); found != nil {
+				return found
+			}
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			if found := unknownKey(node.Content[i], t.Elem(), name); found != nil {
+				return found
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for _, item := range node.Content {
+			if found := unknownKey(item, t.Elem(), name); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+
+}
+
+// jsonField returns the type of the struct field the JSON decoder puts the key in, the embedded structs included.
+func jsonField(t reflect.Type, key string) (reflect.Type, bool) {
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if fieldType, ok := jsonField(embedded, key); ok {
+					return fieldType, true
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) { // The decoder falls back to a case insensitive match
+			return f.Type, true
+		}
+	}
+	return nil, false
+
+}
+
+var pathSegment = regexp.MustCompile(`[^.\[\]]+|\[[^\]]*\]`)
+
+// position follows a field path like rules[0].tolerations[1].effect through the YAML nodes & returns the position
+// of the deepest node it could reach.
+func position(root *yaml.Node, path string) (int, int) {
+
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) != 0 {
+		node = node.Content[0]
+	}
+	line, column := node.Line, node.Column
+	for _, segment := range pathSegment.FindAllString(path, -1) {
+		segment = strings.TrimSuffix(strings.TrimPrefix(segment, "["), "]")
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == segment {
+					line, column = node.Content[i].Line, node.Content[i].Column
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+				line, column = next.Line, next.Column
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line, column
+
+}
+
+// validateTolerations follows the rules the API server applies to the tolerations of a pod.
+func validateTolerations(tols []corev1.Toleration, fldPath *field.Path) field.ErrorList {
+
+	errs := field.ErrorList{}
+	for i, t := range tols {
+		idxPath := fldPath.Index(i)
+		if t.Key != "" {
+			for _, msg := range validation.IsQualifiedName(t.Key) {
+				errs = append(errs, field.Invalid(idxPath.Child("key"), t.Key, msg))
+			}
+		}
+		if t.Key == "" && t.Operator != corev1.TolerationOpExists {
+			errs = append(errs, field.Invalid(idxPath.Child("operator"), t.Operator, "operator must be Exists when `key` is empty, which means \"match all values and all keys\""))
+		}
+		if t.TolerationSeconds != nil && t.Effect != corev1.TaintEffectNoExecute {
+			errs = append(errs, field.Invalid(idxPath.Child("effect"), t.Effect, "effect must be 'NoExecute' when `tolerationSeconds` is set"))
+		}
+		switch t.Operator {
+		case corev1.TolerationOpEqual, "":
+			for _, msg := range validation.IsValidLabelValue(t.Value) {
+				errs = append(errs, field.Invalid(idxPath.Child("value"), t.Value, msg))
+			}
+		case corev1.TolerationOpExists:
+			if t.Value != "" {
+				errs = append(errs, field.Invalid(idxPath.Child("value"), t.Value, "value must be empty when `operator` is 'Exists'"))
+			}
+		default:
+			errs = append(errs, field.NotSupported(idxPath.Child("operator"), t.Operator, []string{string(corev1.TolerationOpEqual), string(corev1.TolerationOpExists)}))
+		}
+		switch t.Effect {
+		case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			errs = append(errs, field.NotSupported(idxPath.Child("effect"), t.Effect, []string{string(corev1.TaintEffectNoSchedule), string(corev1.TaintEffectPreferNoSchedule), string(corev1.TaintEffectNoExecute)}))
+		}
+	}
+	return errs
+
+}
+
+// validateNodeSelector checks the keys & values are valid node labels, the errors are keyed by the label so that
+// they point at it in the file.
+func validateNodeSelector(selector map[string]string, fldPath *field.Path) field.ErrorList {
+
+	keys := make([]string, 0, len(selector))
+	for key := range selector {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	errs := field.ErrorList{}
+	for _, key := range keys {
+		value := selector[key]
+		errs = append(errs, metav1validation.ValidateLabelName(key, fldPath.Key(key))...)
+		for _, msg := range validation.IsValidLabelValue(value) {
+			errs = append(errs, field.Invalid(fldPath.Key(key), value, msg))
+		}
+	}
+	return errs
+
+}
+
+// configLoaders are the config files ValidateConfig knows, keyed by the kind given to validate-config.
+var configLoaders = map[string]func(data []byte) error{
+	"tolerations":             func(data []byte) error { _, err := loadTolerations(data); return err },
+	"selectors":               func(data []byte) error { _, err := loadNodeSelectors(data); return err },
+	"placement":               func(data []byte) error { _, err := loadRolePlacements(data); return err },
+	"failover":                func(data []byte) error { _, err := loadFailoverTolerations(data); return err },
+	"rules":                   func(data []byte) error { _, err := loadRules(data); return err },
+	"allowlist":               func(data []byte) error { _, err := loadAllowlist(data); return err },
+	"namespace-bounds":        func(data []byte) error { _, err := loadNamespaceBounds(data); return err },
+	"dbcluster-policy":        func(data []byte) error { _, err := loadDBClusterPolicy(data); return err },
+	"dbcluster-update-policy": func(data []byte) error { _, err := loadDBClusterUpdatePolicy(data); return err },
+	"backupplan-policy":       func(data []byte) error { _, err := loadBackupPlanPolicy(data); return err },
+	"change-windows":          func(data []byte) error { _, err := loadChangeWindows(data); return err },
+	"sidecar-policy":          func(data []byte) error { _, err := loadSidecarPolicy(data); return err },
+	"readpool-quota":          func(data []byte) error { _, err := loadReadPoolQuotas(data); return err },
+}
+
+// ConfigKinds lists the kinds of config files ValidateConfig accepts.
+func ConfigKinds() []string {
+	kinds := make([]string, 0, len(configLoaders))
+	for kind := range configLoaders {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// ValidateConfig loads the config file the way the webhook does at startup without keeping it, every error found is
+// returned with its position in the file.
+func ValidateConfig(kind string, data []byte) error {
+	load, ok := configLoaders[kind]
+	if !ok {
+		return fmt.Errorf("unknown config kind %q, must be one of %s", kind, strings.Join(ConfigKinds(), ", "))
+	}
+	return load(data)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		id      int
+		name    string
+		data    string
+		want    []corev1.Toleration
+		wantErr string
+	}{
+		{
+			name: "YAML Config",
+			id:   0,
+			data: "- key: cloud.google.com/alloydb-host\n  operator: Exists\n  effect: NoSchedule\n",
+			want: []corev1.Toleration{{Key: "cloud.google.com/alloydb-host", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+		},
+		{
+			name: "JSON Config",
+			id:   1,
+			data: `[{"key": "cloud.google.com/alloydb-host", "operator": "Exists", "effect": "NoSchedule"}]`,
+			want: []corev1.Toleration{{Key: "cloud.google.com/alloydb-host", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+		},
+		{
+			name:    "Unknown Field",
+			id:      2,
+			data:    "- key: cloud.google.com/alloydb-host\n  operator: Exists\n  efect: NoSchedule\n",
+			wantErr: `line 3, column 3: json: unknown field "efect"`,
+		},
+		{
+			name:    "Value With Exists Operator",
+			id:      3,
+			data:    "- key: cloud.google.com/alloydb-host\n  operator: Exists\n  value: \"true\"\n",
+			wantErr: `line 3, column 3: [0].value: Invalid value: "true": value must be empty when ` + "`operator`" + ` is 'Exists'`,
+		},
+		{
+			name:    "Invalid Key",
+			id:      4,
+			data:    "- key: cloud.google.com/alloydb host\n  operator: Exists\n",
+			wantErr: `line 1, column 3: [0].key: Invalid value: "cloud.google.com/alloydb host": name part must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyName',  or 'my.name',  or '123-abc', regex used for validation is '([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]')`,
+		},
+		{
+			name:    "Wrong Type",
+			id:      5,
+			data:    "- key: cloud.google.com/alloydb-host\n  operator: Exists\n  tolerationSeconds: forever\n",
+			wantErr: "line 3, column 3: json: cannot unmarshal string into Go struct field .0.tolerationSeconds of type int64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadTolerations([]byte(tt.data))
+
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("\t%s\tTest ID=%d::Got error %v, want %s", failed, tt.id, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("\t%s\tTest ID=%d::Unexpected error:: %v", failed, tt.id, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got tolerations %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRulePositions(t *testing.T) {
+	data := `evaluation: merge-all
+rules:
+  - name: databases
+    namespaceSelector:
+      matchLabels:
+        "bad key!": "true"
+    nodeSelector:
+      pool: "db pool"
+`
+	want := "line 5, column 7: rules[0].namespaceSelector.matchLabels: Invalid value: \"bad key!\": name part must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyName',  or 'my.name',  or '123-abc', regex used for validation is '([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]')\n" +
+		"line 8, column 7: rules[0].nodeSelector[pool]: Invalid value: \"db pool\": a valid label must be an empty string or consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyValue',  or 'my_value',  or '12345', regex used for validation is '(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?')"
+
+	if _, err := loadRules([]byte(data)); err == nil || err.Error() != want {
+		t.Errorf("\t%s\tGot error %v, want %s", failed, err, want)
+	}
+}
+
+func TestLoadConfigDecodePositions(t *testing.T) {
+	tests := []struct {
+		id      int
+		name    string
+		kind    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "Wrong Type Under The Second Role",
+			id:      0,
+			kind:    "placement",
+			data:    "database:\n  tolerations:\n    - key: dedicated\n      operator: Exists\n      effect: NoExecute\n      tolerationSeconds: 30\nbackup:\n  tolerations:\n    - key: spot\n      operator: Exists\n      effect: NoExecute\n      tolerationSeconds: forever\n",
+			wantErr: "line 12, column 7: json: cannot unmarshal string into Go struct field .backup.tolerations.0.tolerationSeconds of type int64",
+		},
+		{
+			name:    "Key Unknown Only Where It Is",
+			id:      1,
+			kind:    "rules",
+			data:    "rules:\n  - name: databases\n    nodeSelector:\n      pool: db\n  - name: spot\n    tolerations:\n      - key: spot\n        operator: Exists\n        nodeSelector: spot\n",
+			wantErr: `line 9, column 9: json: unknown field "nodeSelector"`,
+		},
+		{
+			name:    "Node Label Holding Dots",
+			id:      2,
+			kind:    "placement",
+			data:    "database:\n  nodeSelector:\n    cloud.google.com/gke-nodepool: [db]\n",
+			wantErr: "line 3, column 5: json: cannot unmarshal array into Go struct field .database.nodeSelector.cloud.google.com~1gke-nodepool of type string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfig(tt.kind, []byte(tt.data))
+
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("\t%s\tTest ID=%d::Got error %v, want %s", failed, tt.id, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		id      int
+		name    string
+		kind    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "Valid Rules",
+			id:   0,
+			kind: "rules",
+			data: "evaluation: first-match\nrules:\n  - name: databases\n    roles: [database]\n",
+		},
+		{
+			name:    "Unknown Role In Failover",
+			id:      1,
+			kind:    "failover",
+			data:    "primary:\n  notReady: 30\nleader:\n  notReady: -1\n",
+			wantErr: "line 3, column 1: leader: Unsupported value: \"leader\": supported values: \"primary\", \"standby\", \"readpool\", \"pgbouncer\", \"backup\", \"monitoring\", \"database\", \"default\"\nline 4, column 3: leader.notReady: Invalid value: -1: must not be negative",
+		},
+		{
+			name:    "Unknown Kind",
+			id:      2,
+			kind:    "taints",
+			data:    "[]",
+			wantErr: `unknown config kind "taints", must be one of allowlist, backupplan-policy, change-windows, dbcluster-policy, dbcluster-update-policy, failover, namespace-bounds, placement, readpool-quota, rules, selectors, sidecar-policy, tolerations`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfig(tt.kind, []byte(tt.data))
+
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("\t%s\tTest ID=%d::Got error %v, want %s", failed, tt.id, err, tt.wantErr)
+			}
+		})
+	}
+}
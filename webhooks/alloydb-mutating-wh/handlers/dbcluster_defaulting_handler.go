@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	log "k8s.io/klog/v2"
+)
+
+var mutatingRoutes = map[string]AdmitFunc{} // The mutators of the AlloyDB resources, keyed by the path like validatingRoutes
+
+// BuildDBClusterDefaulting serves the DBCluster mutator at /mutate/dbcluster when DBCLUSTER_DEFAULTING is set to true,
+// it declares the tolerations & node selectors of BuildTolerations() & BuildSelectors() in the schedulingconfig of the
+// new DBClusters so the operator renders them into the pods.
+func BuildDBClusterDefaulting() {
+	value := os.Getenv("DBCLUSTER_DEFAULTING")
+	if value == "" {
+		return
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		configFailed("dbcluster-defaulting", "handlers.BuildDBClusterDefaulting():Invalid value %q for DBCLUSTER_DEFAULTING:: %v", value, err)
+		return
+	}
+	if !enabled {
+		return
+	}
+	mutatingRoutes["/mutate/dbcluster"] = mutateDBCluster
+	log.Info("handlers.BuildDBClusterDefaulting():Enabled the DBCluster schedulingconfig defaulting")
+
+}
+
+func mutateDBCluster(ar *v1beta1.AdmissionReview, tols []corev1.Toleration) *v1beta1.AdmissionResponse {
+
+	if resp := configFailureResponse(ar, "DBCluster was not defaulted", "dbcluster-defaulting"); resp != nil {
+		return resp
+	}
+	allowed := &v1beta1.AdmissionResponse{
+		UID:     ar.Request.UID,
+		Allowed: true,
+		Result: &metav1.Status{
+			Status: "Success",
+		},
+	}
+	if ar.Request.Operation != v1beta1.Create {
+		return allowed // A changed schedulingconfig reschedules the pods of an existing DBCluster
+	}
+	ops, warnings, err := schedulingConfigPatch(ar.Request.Object.Raw, tols, nodeSelectors)
+	if err != nil {
+		log.Errorf("handlers.mutateDBCluster():Could not default the DBCluster %s/%s:: %v", ar.Request.Namespace, ar.Request.Name, err)
+		return &v1beta1.AdmissionResponse{
+			UID:     ar.Request.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+	allowed.Warnings = warnings
+	if len(ops) == 0 {
+		return allowed
+	}
+	patch, err := constructPatch(ops)
+	if err != nil {
+		log.Errorf("handlers.mutateDBCluster():Could not create a patch for the DBCluster:: %v", err)
+		return &v1beta1.AdmissionResponse{
+			UID:     ar.Request.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+	log.Infof("handlers.mutateDBCluster():Defaulted the schedulingconfig of the DBCluster %s/%s", ar.Request.Namespace, ar.Request.Name)
+	allowed.Patch = patch
+	pt := v1beta1.PatchTypeJSONPatch
+	allowed.PatchType = &pt
+	return allowed
+
+}
+
+// schedulingConfigPatch adds the tolerations whose key the DBCluster doesn't tolerate yet & turns the node selectors
+// into a required node affinity when the DBCluster doesn't require one, the other schedulingconfig fields are kept.
+func schedulingConfigPatch(raw []byte, tols []corev1.Toleration, selectors map[string]string) ([]patchOperation, []string, error) {
+
+	cluster := &DBCluster{}
+	if err := json.Unmarshal(raw, cluster); err != nil {
+		return nil, nil, err
+	}
+	object := map[string]interface{}{} // Keeps the fields DBCluster leaves out
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, nil, err
+	}
+	spec, _ := object["spec"].(map[string]interface{})
+	primarySpec, ok := spec["primarySpec"].(map[string]interface{})
+	if !ok {
+		return nil, nil, nil // Rejected by the operator's CRD
+	}
+	schedulingConfig, ok := primarySpec["schedulingconfig"].(map[string]interface{})
+	if !ok {
+		schedulingConfig = map[string]interface{}{}
+	}
+	existing := cluster.Spec.PrimarySpec.SchedulingConfig
+	if existing == nil {
+		existing = &SchedulingConfig{}
+	}
+
+	changed := false
+	warnings := []string{}
+	merged := mergeTolerations(existing.Tolerations, tols, nil)
+	if len(merged) != len(existing.Tolerations) {
+		schedulingConfig["tolerations"] = merged
+		changed = true
+	}
+	if len(selectors) != 0 {
+		if existing.NodeAffinity != nil && existing.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+			warnings = append(warnings, fmt.Sprintf("schedulingconfig.nodeaffinity of the DBCluster already has a required node affinity, the node selector %v was not added", selectors))
+		} else {
+			affinity := existing.NodeAffinity
+			if affinity == nil {
+				affinity = &corev1.NodeAffinity{}
+			}
+			affinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: selectorRequirements(selectors)}},
+			}
+			schedulingConfig["nodeaffinity"] = affinity
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, warnings, nil
+	}
+	return []patchOperation{{Op: "add", Path: "/spec/primarySpec/schedulingconfig", Value: schedulingConfig}}, warnings, nil
+
+}
+
+// selectorRequirements turns a node selector into the equivalent node selector requirements, sorted by key.
+func selectorRequirements(selectors map[string]string) []corev1.NodeSelectorRequirement {
+
+	keys := make([]string, 0, len(selectors))
+	for k := range selectors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	reqs := []corev1.NodeSelectorRequirement{}
+	for _, k := range keys {
+		reqs = append(reqs, corev1.NodeSelectorRequirement{Key: k, Operator: corev1.NodeSelectorOpIn, Values: []string{selectors[k]}})
+	}
+	return reqs
+
+}
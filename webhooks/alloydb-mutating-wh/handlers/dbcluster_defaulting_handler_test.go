@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMutateDBCluster(t *testing.T) {
+	tests := []struct {
+		id           int
+		name         string
+		object       string
+		update       bool
+		wantPatch    string
+		wantWarnings int
+	}{
+		{
+			name:      "No Scheduling Config",
+			id:        0,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "dbcluster-sample"}, "spec": {"databaseVersion": "17.5.0", "primarySpec": {"resources": {"cpu": 1, "memory": "5Gi"}}}}`,
+			wantPatch: `[{"op":"add","path":"/spec/primarySpec/schedulingconfig","value":{"nodeaffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"disk","operator":"In","values":["ssd"]},{"key":"node-type","operator":"In","values":["database"]}]}]}},"tolerations":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]}}]`,
+		},
+		{
+			name:      "Topology Spread Constraints Kept",
+			id:        1,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "dbcluster-sample"}, "spec": {"primarySpec": {"schedulingconfig": {"topologySpreadConstraints": [{"maxSkew": 1, "topologyKey": "topology.kubernetes.io/zone", "whenUnsatisfiable": "DoNotSchedule"}]}}}}`,
+			wantPatch: `[{"op":"add","path":"/spec/primarySpec/schedulingconfig","value":{"nodeaffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"disk","operator":"In","values":["ssd"]},{"key":"node-type","operator":"In","values":["database"]}]}]}},"tolerations":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}],"topologySpreadConstraints":[{"maxSkew":1,"topologyKey":"topology.kubernetes.io/zone","whenUnsatisfiable":"DoNotSchedule"}]}}]`,
+		},
+		{
+			name:         "Explicit Toleration And Required Affinity Left Alone",
+			id:           2,
+			object:       `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "dbcluster-sample"}, "spec": {"primarySpec": {"schedulingconfig": {"tolerations": [{"key": "cloud.google.com/alloydb-host", "operator": "Equal", "value": "pool-b", "effect": "NoSchedule"}], "nodeaffinity": {"requiredDuringSchedulingIgnoredDuringExecution": {"nodeSelectorTerms": [{"matchExpressions": [{"key": "pool", "operator": "In", "values": ["b"]}]}]}}}}}}`,
+			wantPatch:    "",
+			wantWarnings: 1,
+		},
+		{
+			name:      "Preferred Affinity Kept Next To The Required One",
+			id:        3,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "dbcluster-sample"}, "spec": {"primarySpec": {"schedulingconfig": {"tolerations": [{"key": "dedicated", "operator": "Exists"}], "nodeaffinity": {"preferredDuringSchedulingIgnoredDuringExecution": [{"weight": 10, "preference": {"matchExpressions": [{"key": "zone", "operator": "In", "values": ["a"]}]}}]}}}}}`,
+			wantPatch: `[{"op":"add","path":"/spec/primarySpec/schedulingconfig","value":{"nodeaffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"disk","operator":"In","values":["ssd"]},{"key":"node-type","operator":"In","values":["database"]}]}]},"preferredDuringSchedulingIgnoredDuringExecution":[{"weight":10,"preference":{"matchExpressions":[{"key":"zone","operator":"In","values":["a"]}]}}]},"tolerations":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"},{"key":"dedicated","operator":"Exists"}]}}]`,
+		},
+		{
+			name:      "Existing Cluster Not Defaulted",
+			id:        4,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "dbcluster-sample", "labels": {"team": "payments"}}, "spec": {"databaseVersion": "17.5.0", "primarySpec": {}}}`,
+			update:    true,
+			wantPatch: "",
+		},
+	}
+
+	setTestNodeSelectors(t)
+	setTestDBClusterDefaulting(t)
+	tols := []corev1.Toleration{{Key: "cloud.google.com/alloydb-host", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      "dbcluster-sample",
+					Namespace: "db",
+					Operation: v1beta1.Create,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+				},
+			}
+			if tt.update {
+				ar.Request.Operation = v1beta1.Update
+			}
+			got := mutatingRoutes["/mutate/dbcluster"](ar, tols)
+
+			if !got.Allowed {
+				t.Fatalf("\t%s\tTest ID=%d::The DBCluster was denied:: %+v", failed, tt.id, got.Result)
+			}
+			if string(got.Patch) != tt.wantPatch {
+				t.Errorf("\t%s\tTest ID=%d::Got the patch %s, want %s", failed, tt.id, got.Patch, tt.wantPatch)
+			}
+			if len(got.Warnings) != tt.wantWarnings {
+				t.Errorf("\t%s\tTest ID=%d::Got the warnings %v, want %d", failed, tt.id, got.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func setTestDBClusterDefaulting(t *testing.T) {
+
+	savedRoute := mutatingRoutes["/mutate/dbcluster"]
+	mutatingRoutes["/mutate/dbcluster"] = mutateDBCluster
+	t.Cleanup(func() {
+		if savedRoute == nil {
+			delete(mutatingRoutes, "/mutate/dbcluster")
+		} else {
+			mutatingRoutes["/mutate/dbcluster"] = savedRoute
+		}
+	})
+
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ParameterPolicy is the parameters section of the DBCluster policy, the Postgres parameters of a DBCluster are also
+// checked against the built-in catalog of their types, ranges & units.
+type ParameterPolicy struct {
+	// Denied maps a parameter to the values the organization forbids, like fsync: ["off"], every value when empty.
+	Denied map[string][]parameterValue `json:"denied,omitempty"`
+	// Allowed are parameters the catalog doesn't know that may be set without any check, the ones with a dot like
+	// pg_stat_statements.max belong to extensions & are always allowed.
+	Allowed []string `json:"allowed,omitempty"`
+	// MemoryPercent bounds the shared memory the parameters reserve, shared_buffers foremost, to a percentage of the
+	// memory of the DBCluster, 80 when not set.
+	MemoryPercent *int64 `json:"memoryPercent,omitempty"`
+
+	denied map[string][]string // Normalized
+}
+
+// parameterValue is a parameter value in the config, where YAML turns off into false & 10 into a number.
+type parameterValue string
+
+func (v *parameterValue) UnmarshalJSON(data []byte) error {
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = parameterValue(s)
+		return nil
+	}
+	var scalar interface{}
+	if err := json.Unmarshal(data, &scalar); err != nil {
+		return err
+	}
+	switch scalar.(type) {
+	case bool, float64:
+		*v = parameterValue(data)
+		return nil
+	}
+	return fmt.Errorf("a parameter value must be a string, a number or a boolean, not %s", data)
+
+}
+
+type parameterType int
+
+const (
+	stringParameter parameterType = iota // Of the parameters the catalog doesn't know as well
+	boolParameter
+	integerParameter
+	realParameter
+	enumParameter
+)
+
+// memoryUse tells how the memory of a parameter counts against the memory of the DBCluster.
+type memoryUse int
+
+const (
+	noMemory     memoryUse = iota
+	sharedMemory           // Reserved at start up, summed
+	perBackend             // Allocated by each backend or operation, must fit on its own
+)
+
+type parameterSpec struct {
+	kind     parameterType
+	unit     string // The unit of a number without one, kB, 8kB, MB, ms, s or min
+	min, max float64
+	values   []string // Of an enum
+	memory   memoryUse
+}
+
+const maxInt = math.MaxInt32
+
+var logLevels = []string{"debug5", "debug4", "debug3", "debug2", "debug1", "info", "notice", "warning", "error", "log", "fatal", "panic"}
+
+// parameterCatalog holds the Postgres parameters the DBClusters commonly set, the ranges are the ones of Postgres 17.
+var parameterCatalog = map[string]parameterSpec{
+	"max_connections":                          {kind: integerParameter, min: 1, max: 262143},
+	"superuser_reserved_connections":           {kind: integerParameter, min: 0, max: 262143},
+	"shared_buffers":                           {kind: integerParameter, unit: "8kB", min: 16, max: 1073741823, memory: sharedMemory},
+	"wal_buffers":                              {kind: integerParameter, unit: "8kB", min: -1, max: 262143, memory: sharedMemory},
+	"huge_pages":                               {kind: enumParameter, values: []string{"off", "on", "try"}},
+	"temp_buffers":                             {kind: integerParameter, unit: "8kB", min: 100, max: 1073741823, memory: perBackend},
+	"work_mem":                                 {kind: integerParameter, unit: "kB", min: 64, max: maxInt, memory: perBackend},
+	"maintenance_work_mem":                     {kind: integerParameter, unit: "kB", min: 1024, max: maxInt, memory: perBackend},
+	"autovacuum_work_mem":                      {kind: integerParameter, unit: "kB", min: -1, max: maxInt, memory: perBackend},
+	"effective_cache_size":                     {kind: integerParameter, unit: "8kB", min: 1, max: maxInt},
+	"max_wal_size":                             {kind: integerParameter, unit: "MB", min: 2, max: maxInt},
+	"min_wal_size":                             {kind: integerParameter, unit: "MB", min: 2, max: maxInt},
+	"checkpoint_timeout":                       {kind: integerParameter, unit: "s", min: 30, max: 86400},
+	"checkpoint_completion_target":             {kind: realParameter, min: 0, max: 1},
+	"random_page_cost":                         {kind: realParameter, min: 0, max: math.MaxFloat64},
+	"seq_page_cost":                            {kind: realParameter, min: 0, max: math.MaxFloat64},
+	"effective_io_concurrency":                 {kind: integerParameter, min: 0, max: 1000},
+	"max_worker_processes":                     {kind: integerParameter, min: 0, max: 262143},
+	"max_parallel_workers":                     {kind: integerParameter, min: 0, max: 1024},
+	"max_parallel_workers_per_gather":          {kind: integerParameter, min: 0, max: 1024},
+	"max_parallel_maintenance_workers":         {kind: integerParameter, min: 0, max: 1024},
+	"max_locks_per_transaction":                {kind: integerParameter, min: 10, max: maxInt},
+	"statement_timeout":                        {kind: integerParameter, unit: "ms", min: 0, max: maxInt},
+	"lock_timeout":                             {kind: integerParameter, unit: "ms", min: 0, max: maxInt},
+	"idle_in_transaction_session_timeout":      {kind: integerParameter, unit: "ms", min: 0, max: maxInt},
+	"log_min_duration_statement":               {kind: integerParameter, unit: "ms", min: -1, max: maxInt},
+	"log_statement":                            {kind: enumParameter, values: []string{"none", "ddl", "mod", "all"}},
+	"log_min_messages":                         {kind: enumParameter, values: logLevels},
+	"fsync":                                    {kind: boolParameter},
+	"full_page_writes":                         {kind: boolParameter},
+	"autovacuum":                               {kind: boolParameter},
+	"synchronous_commit":                       {kind: enumParameter, values: []string{"local", "remote_write", "remote_apply", "on", "off"}},
+	"wal_level":                                {kind: enumParameter, values: []string{"minimal", "replica", "logical"}},
+	"timezone":                                 {kind: stringParameter},
+	"google_columnar_engine.enabled":           {kind: boolParameter},
+	"google_columnar_engine.memory_size_in_mb": {kind: integerParameter, unit: "MB", min: 0, max: maxInt, memory: sharedMemory},
+}
+
+// Sizes of the units Postgres accepts, in bytes for the memory & in milliseconds for the time.
+var (
+	memoryUnits = map[string]float64{"B": 1, "kB": 1 << 10, "8kB": 8 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40}
+	timeUnits   = map[string]float64{"us": 0.001, "ms": 1, "s": 1000, "min": 60000, "h": 3600000, "d": 86400000}
+)
+
+var numberWithUnit = regexp.MustCompile(`^\s*([-+]?[0-9]*\.?[0-9]+(?:[eE][-+]?[0-9]+)?)\s*([A-Za-z]*)\s*$`)
+
+var boolValues = map[string]string{"on": "on", "true": "on", "yes": "on", "1": "on", "off": "off", "false": "off", "no": "off", "0": "off"}
+
+func (p *ParameterPolicy) validate(fldPath *field.Path) field.ErrorList {
+
+	errs := field.ErrorList{}
+	p.denied = map[string][]string{}
+	for name, values := range p.Denied {
+		name = strings.ToLower(name)
+		spec, known := parameterCatalog[name]
+		p.denied[name] = []string{}
+		for i, v := range values {
+			value := string(v)
+			if known {
+				if _, err := spec.parse(value); err != nil {
+					errs = append(errs, field.Invalid(fldPath.Child("denied").Key(name).Index(i), value, err.Error()))
+					continue
+				}
+			}
+			p.denied[name] = append(p.denied[name], normalizeParameter(spec, value))
+		}
+	}
+	if p.MemoryPercent != nil && (*p.MemoryPercent < 1 || *p.MemoryPercent > 100) {
+		errs = append(errs, field.Invalid(fldPath.Child("memoryPercent"), *p.MemoryPercent, "must be between 1 and 100"))
+	}
+	return errs
+
+}
+
+// check returns the errors of the parameters of a DBCluster given the memory it requests.
+func (p *ParameterPolicy) check(parameters map[string]string, memory *resource.Quantity, fldPath *field.Path) field.ErrorList {
+
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := field.ErrorList{}
+	shared, sharedNames := 0.0, []string{}
+	for _, name := range names {
+		value, paramPath, key := parameters[name], fldPath.Key(name), strings.ToLower(name) // Postgres ignores the case
+		spec, known := parameterCatalog[key]
+		if values, ok := p.denied[key]; ok && (len(values) == 0 || containsString(values, normalizeParameter(spec, value))) {
+			errs = append(errs, field.Forbidden(paramPath, fmt.Sprintf("%s=%s is denied by the organization", name, value)))
+			continue
+		}
+		if !known {
+			if !strings.Contains(name, ".") && !containsString(p.Allowed, key) {
+				errs = append(errs, field.NotSupported(paramPath, name, []string{"a known Postgres parameter or one added to the allowed parameters of the DBCluster policy"}))
+			}
+			continue
+		}
+		number, err := spec.parse(value)
+		if err != nil {
+			errs = append(errs, field.Invalid(paramPath, value, err.Error()))
+			continue
+		}
+		if memory == nil || spec.memory == noMemory || number < 0 {
+			continue // -1 lets Postgres size it
+		}
+		bytes := number * memoryUnits[spec.unit]
+		switch spec.memory {
+		case sharedMemory:
+			shared += bytes
+			sharedNames = append(sharedNames, name)
+		case perBackend:
+			if bytes >= memory.AsApproximateFloat64() {
+				errs = append(errs, field.Invalid(paramPath, value, fmt.Sprintf("must be less than the memory of the DBCluster, %s", memory)))
+			}
+		}
+	}
+
+	if memory != nil && len(sharedNames) != 0 {
+		percent := int64(80)
+		if p.MemoryPercent != nil {
+			percent = *p.MemoryPercent
+		}
+		if limit := memory.AsApproximateFloat64() * float64(percent) / 100; shared > limit {
+			errs = append(errs, field.Invalid(fldPath.Key(sharedNames[0]), parameters[sharedNames[0]], fmt.Sprintf(
+				"%s reserve %s of shared memory, over %d%% of the memory of the DBCluster, %s",
+				strings.Join(sharedNames, " & "), resource.NewQuantity(int64(shared), resource.BinarySI), percent, memory)))
+		}
+	}
+	return errs
+
+}
+
+// parse checks the value against the type, unit & range of the parameter & returns it as a number of its unit, 0 for
+// the parameters that aren't numbers.
+func (s parameterSpec) parse(value string) (float64, error) {
+
+	switch s.kind {
+	case boolParameter:
+		if _, ok := boolValues[strings.ToLower(strings.TrimSpace(value))]; !ok {
+			return 0, fmt.Errorf("must be a boolean, on or off")
+		}
+		return 0, nil
+	case enumParameter:
+		if !containsString(s.values, strings.ToLower(strings.TrimSpace(value))) {
+			return 0, fmt.Errorf("must be one of %s", strings.Join(s.values, ", "))
+		}
+		return 0, nil
+	case stringParameter:
+		return 0, nil
+	}
+
+	m := numberWithUnit.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("must be a number%s", s.unitHint())
+	}
+	number, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("must be a number%s", s.unitHint())
+	}
+	if unit := m[2]; unit != "" {
+		units := memoryUnits
+		if _, ok := timeUnits[s.unit]; ok {
+			units = timeUnits
+		}
+		size, ok := units[unit]
+		if s.unit == "" || !ok || unit == "8kB" {
+			return 0, fmt.Errorf("has an invalid unit %q%s", unit, s.unitHint())
+		}
+		number = number * size / units[s.unit]
+	}
+	if s.kind == integerParameter {
+		if m[2] == "" && number != math.Trunc(number) {
+			return 0, fmt.Errorf("must be an integer%s", s.unitHint())
+		}
+		number = math.Round(number)
+	}
+	minimum, maximum := strconv.FormatFloat(s.min, 'f', -1, 64), strconv.FormatFloat(s.max, 'f', -1, 64)
+	switch {
+	case s.max == math.MaxFloat64 && number < s.min:
+		return 0, fmt.Errorf("must be at least %s%s", minimum, s.unitHint())
+	case number < s.min || number > s.max:
+		return 0, fmt.Errorf("must be between %s and %s%s", minimum, maximum, s.unitHint())
+	}
+	return number, nil
+
+}
+
+func (s parameterSpec) unitHint() string {
+
+	switch {
+	case s.unit == "":
+		return ""
+	case memoryUnits[s.unit] != 0:
+		return fmt.Sprintf(" of %s or with a unit of B, kB, MB, GB or TB", s.unit)
+	default:
+		return fmt.Sprintf(" of %s or with a unit of us, ms, s, min, h or d", s.unit)
+	}
+
+}
+
+// normalizeParameter makes the equivalent values of a parameter compare equal, like off & false.
+func normalizeParameter(spec parameterSpec, value string) string {
+
+	value = strings.TrimSpace(value)
+	switch spec.kind {
+	case boolParameter:
+		if v, ok := boolValues[strings.ToLower(value)]; ok {
+			return v
+		}
+	case enumParameter:
+		return strings.ToLower(value)
+	}
+	return value
+
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestParseParameter(t *testing.T) {
+	tests := []struct {
+		id      int
+		name    string
+		param   string
+		value   string
+		want    float64
+		wantErr string
+	}{
+		{name: "Buffers Of 8kB", id: 0, param: "shared_buffers", value: "16384", want: 16384},
+		{name: "Buffers With A Unit", id: 1, param: "shared_buffers", value: "1GB", want: 131072},
+		{name: "Fraction Of A Unit", id: 2, param: "work_mem", value: "1.5MB", want: 1536},
+		{name: "Time With A Unit", id: 3, param: "statement_timeout", value: "2min", want: 120000},
+		{name: "Below The Minimum", id: 4, param: "shared_buffers", value: "64kB", wantErr: "must be between 16 and 1073741823"},
+		{name: "Time Unit For Memory", id: 5, param: "work_mem", value: "5s", wantErr: `invalid unit "s"`},
+		{name: "Unit On A Count", id: 6, param: "max_connections", value: "100MB", wantErr: `invalid unit "MB"`},
+		{name: "Fractional Count", id: 7, param: "max_connections", value: "100.5", wantErr: "must be an integer"},
+		{name: "Real", id: 8, param: "checkpoint_completion_target", value: "0.9", want: 0.9},
+		{name: "Real Out Of Range", id: 9, param: "checkpoint_completion_target", value: "1.5", wantErr: "must be between 0 and 1"},
+		{name: "Boolean", id: 10, param: "fsync", value: "False"},
+		{name: "Invalid Boolean", id: 11, param: "fsync", value: "maybe", wantErr: "must be a boolean"},
+		{name: "Enum", id: 12, param: "wal_level", value: "Logical"},
+		{name: "Invalid Enum", id: 13, param: "wal_level", value: "archive", wantErr: "must be one of minimal, replica, logical"},
+		{name: "Not A Number", id: 14, param: "max_wal_size", value: "lots", wantErr: "must be a number of MB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parameterCatalog[tt.param].parse(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("\t%s\tTest ID=%d::Got the error %v, want one about %s", failed, tt.id, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("\t%s\tTest ID=%d::Got %v, %v, want %v", failed, tt.id, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckParameters(t *testing.T) {
+	tests := []struct {
+		id         int
+		name       string
+		parameters map[string]string
+		memory     string
+		wantFields []string
+		wantDetail string
+	}{
+		{
+			name:       "Sample Parameters",
+			id:         0,
+			parameters: map[string]string{"google_columnar_engine.enabled": "on", "google_columnar_engine.memory_size_in_mb": "256"},
+			memory:     "5Gi",
+		},
+		{
+			name:       "Tuned Cluster",
+			id:         1,
+			parameters: map[string]string{"shared_buffers": "4GB", "work_mem": "64MB", "max_connections": "200", "Synchronous_Commit": "remote_apply", "pg_stat_statements.max": "10000", "jit": "off"},
+			memory:     "16Gi",
+		},
+		{
+			name:       "Denied Values",
+			id:         2,
+			parameters: map[string]string{"fsync": "false", "full_page_writes": "on", "wal_level": "minimal"},
+			memory:     "16Gi",
+			wantFields: []string{"spec.primarySpec.parameters[fsync]", "spec.primarySpec.parameters[wal_level]"},
+			wantDetail: "fsync=false is denied by the organization",
+		},
+		{
+			name:       "Unknown & Invalid Parameters",
+			id:         3,
+			parameters: map[string]string{"shared_bufers": "1GB", "max_connections": "0", "log_statement": "everything"},
+			memory:     "16Gi",
+			wantFields: []string{"spec.primarySpec.parameters[log_statement]", "spec.primarySpec.parameters[max_connections]", "spec.primarySpec.parameters[shared_bufers]"},
+		},
+		{
+			name:       "Shared Memory Over The Memory",
+			id:         4,
+			parameters: map[string]string{"shared_buffers": "3GB", "google_columnar_engine.memory_size_in_mb": "1024"},
+			memory:     "5Gi",
+			wantFields: []string{"spec.primarySpec.parameters[google_columnar_engine.memory_size_in_mb]"},
+			wantDetail: "google_columnar_engine.memory_size_in_mb & shared_buffers reserve 4Gi of shared memory, over 75% of the memory of the DBCluster, 5Gi",
+		},
+		{
+			name:       "Work Memory Over The Memory",
+			id:         5,
+			parameters: map[string]string{"maintenance_work_mem": "8GB"},
+			memory:     "8Gi",
+			wantFields: []string{"spec.primarySpec.parameters[maintenance_work_mem]"},
+		},
+		{
+			name:       "No Memory Requested",
+			id:         6,
+			parameters: map[string]string{"shared_buffers": "64GB"},
+		},
+	}
+
+	policy, err := loadDBClusterPolicy([]byte("parameters:\n  denied:\n    fsync: [off]\n    wal_level: [minimal]\n    ALTER_SYSTEM: []\n  allowed: [jit]\n  memoryPercent: 75\n"))
+	if err != nil {
+		t.Fatalf("\t%s\tCould not load the parameter policy:: %v", failed, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var memory *resource.Quantity
+			if tt.memory != "" {
+				q := resource.MustParse(tt.memory)
+				memory = &q
+			}
+			errs := policy.Parameters.check(tt.parameters, memory, field.NewPath("spec", "primarySpec", "parameters"))
+
+			fields := []string{}
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			if len(tt.wantFields) == 0 && len(errs) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %v", failed, tt.id, fields, tt.wantFields, errs)
+			}
+			if !strings.Contains(errs.ToAggregate().Error(), tt.wantDetail) {
+				t.Errorf("\t%s\tTest ID=%d::Got the errors %v, want them to contain %q", failed, tt.id, errs, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestLoadParameterPolicy(t *testing.T) {
+	data := "parameters:\n  denied:\n    fsync: [maybe]\n  memoryPercent: 120\n"
+
+	_, err := loadDBClusterPolicy([]byte(data))
+	for _, want := range []string{"line 3, column 13: parameters.denied[fsync][0]", "line 4, column 3: parameters.memoryPercent"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("\t%s\tGot error %v, want one about %s", failed, err, want)
+		}
+	}
+}
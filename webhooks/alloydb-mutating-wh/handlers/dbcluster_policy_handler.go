@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// QuantityRange bounds a resource quantity, a nil bound isn't checked.
+type QuantityRange struct {
+	Min *resource.Quantity `json:"min,omitempty"`
+	Max *resource.Quantity `json:"max,omitempty"`
+}
+
+// DBClusterPolicy is the layout of the file pointed to by DBCLUSTER_POLICY_CONFIG_PATH & DBCLUSTER_POLICY_CONFIG_FILE,
+// an empty field isn't enforced.
+type DBClusterPolicy struct {
+	DatabaseVersions []string      `json:"databaseVersions,omitempty"`
+	CPU              QuantityRange `json:"cpu,omitempty"`
+	Memory           QuantityRange `json:"memory,omitempty"`
+	Disk             QuantityRange `json:"disk,omitempty"` // Applies to each of the disks of the primary
+	StorageClasses   []string      `json:"storageClasses,omitempty"`
+	// HARequiredNamespaceSelector selects the namespaces where the clusters must have at least one standby.
+	HARequiredNamespaceSelector *metav1.LabelSelector `json:"haRequiredNamespaceSelector,omitempty"`
+	// Parameters turns on the checks of the Postgres parameters.
+	Parameters *ParameterPolicy `json:"parameters,omitempty"`
+
+	haRequired labels.Selector
+}
+
+var dbClusterPolicy *DBClusterPolicy
+
+// dbClusterCheck is one of the checks of the DBClusters, enabled by its Build function.
+type dbClusterCheck struct {
+	name    string
+	check   validator
+	configs []string
+}
+
+var dbClusterChecks []dbClusterCheck // In the order of the Build functions
+
+// registerDBClusterCheck adds the check to the DBCluster validator at /validate/dbcluster, so a DBCluster is reviewed
+// once by every enabled check & denied with the fields of all of them. The failure mode answers instead while a config
+// of any of the checks is broken.
+func registerDBClusterCheck(name string, check validator, configs ...string) {
+
+	checks := []dbClusterCheck{}
+	for _, c := range dbClusterChecks {
+		if c.name != name {
+			checks = append(checks, c)
+		}
+	}
+	dbClusterChecks = append(checks, dbClusterCheck{name: name, check: check, configs: configs})
+	allConfigs := []string{}
+	for _, c := range dbClusterChecks {
+		for _, config := range c.configs {
+			if !containsString(allConfigs, config) {
+				allConfigs = append(allConfigs, config)
+			}
+		}
+	}
+	registerValidator("/validate/dbcluster", dbClusterKind, validateDBClusterChecks, allConfigs...)
+
+}
+
+// validateDBClusterChecks runs the enabled checks of the DBClusters in turn.
+func validateDBClusterChecks(req *validationRequest) (field.ErrorList, error) {
+
+	errs := field.ErrorList{}
+	for _, c := range dbClusterChecks {
+		checkErrs, err := c.check(req)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, checkErrs...)
+	}
+	return errs, nil
+
+}
+
+// BuildDBClusterPolicy loads the DBCluster policy & checks the DBClusters against it at /validate/dbcluster when
+// DBCLUSTER_POLICY_CONFIG_FILE is set.
+func BuildDBClusterPolicy() {
+	fileName := os.Getenv("DBCLUSTER_POLICY_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("DBCLUSTER_POLICY_CONFIG_PATH"), fileName)
+	registerDBClusterCheck("dbcluster-policy", validateDBCluster, "dbcluster-policy", "namespaces")
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("dbcluster-policy", "handlers.BuildDBClusterPolicy():Error opening DBCluster policy config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("dbcluster-policy", "handlers.BuildDBClusterPolicy():Error reading the DBCluster policy from the file:: %v", err)
+		return
+	}
+	if dbClusterPolicy, err = loadDBClusterPolicy(data); err != nil {
+		configFailed("dbcluster-policy", "handlers.BuildDBClusterPolicy():Error loading the DBCluster policy from the file %s:: %v", filePath, err)
+		return
+	}
+	configLoaded("dbcluster-policy", filePath, data)
+	if dbClusterPolicy.haRequired != nil && namespaces == nil {
+		namespaces = newNamespaceGetter()
+	}
+	log.Info("handlers.BuildDBClusterPolicy():Enabled the DBCluster policy validation")
+
+}
+
+func loadDBClusterPolicy(data []byte) (*DBClusterPolicy, error) {
+
+	policy := &DBClusterPolicy{}
+	if err := loadConfig(data, policy, policy.validate); err != nil {
+		return nil, err
+	}
+	if policy.HARequiredNamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(policy.HARequiredNamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		policy.haRequired = selector
+	}
+	return policy, nil
+
+}
+
+func (p *DBClusterPolicy) validate() field.ErrorList {
+
+	errs := field.ErrorList{}
+	for i, v := range p.DatabaseVersions {
+		if v == "" {
+			errs = append(errs, field.Required(field.NewPath("databaseVersions").Index(i), ""))
+		}
+	}
+	errs = append(errs, p.CPU.validate(field.NewPath("cpu"))...)
+	errs = append(errs, p.Memory.validate(field.NewPath("memory"))...)
+	errs = append(errs, p.Disk.validate(field.NewPath("disk"))...)
+	if p.HARequiredNamespaceSelector != nil {
+		errs = append(errs, metav1validation.ValidateLabelSelector(p.HARequiredNamespaceSelector, metav1validation.LabelSelectorValidationOptions{}, field.NewPath("haRequiredNamespaceSelector"))...)
+	}
+	if p.Parameters != nil {
+		errs = append(errs, p.Parameters.validate(field.NewPath("parameters"))...)
+	}
+	return errs
+
+}
+
+func (r QuantityRange) validate(fldPath *field.Path) field.ErrorList {
+
+	errs := field.ErrorList{}
+	if r.Min != nil && r.Min.Sign() < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("min"), r.Min.String(), "must not be negative"))
+	}
+	if r.Min != nil && r.Max != nil && r.Min.Cmp(*r.Max) > 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("max"), r.Max.String(), fmt.Sprintf("must not be less than min %s", r.Min)))
+	}
+	return errs
+
+}
+
+// check returns the errors for a quantity out of the range, a missing quantity is only an error when bounded.
+func (r QuantityRange) check(q *resource.Quantity, fldPath *field.Path) field.ErrorList {
+
+	if r.Min == nil && r.Max == nil {
+		return nil
+	}
+	if q == nil {
+		return field.ErrorList{field.Required(fldPath, "the policy bounds it")}
+	}
+	if r.Min != nil && q.Cmp(*r.Min) < 0 {
+		return field.ErrorList{field.Invalid(fldPath, q.String(), fmt.Sprintf("must be at least %s", r.Min))}
+	}
+	if r.Max != nil && q.Cmp(*r.Max) > 0 {
+		return field.ErrorList{field.Invalid(fldPath, q.String(), fmt.Sprintf("must be at most %s", r.Max))}
+	}
+	return nil
+
+}
+
+// validateDBCluster enforces dbClusterPolicy on the DBClusters created or updated, their Postgres parameters included.
+// An update is only denied for the violations it brings, a DBCluster created under a looser policy can still have its
+// metadata & status updated, and one being deleted isn't checked so its finalizers can be removed.
+func validateDBCluster(req *validationRequest) (field.ErrorList, error) {
+
+	if req.ar.Request.Operation != v1beta1.Create && req.ar.Request.Operation != v1beta1.Update {
+		return nil, nil
+	}
+	cluster := &DBCluster{}
+	if err := json.Unmarshal(req.ar.Request.Object.Raw, cluster); err != nil {
+		return nil, err
+	}
+	if cluster.DeletionTimestamp != nil {
+		return nil, nil
+	}
+	errs, err := checkDBClusterPolicy(req, cluster)
+	if err != nil || len(errs) == 0 || req.ar.Request.Operation != v1beta1.Update || len(req.ar.Request.OldObject.Raw) == 0 {
+		return errs, err
+	}
+	oldCluster := &DBCluster{}
+	if err := json.Unmarshal(req.ar.Request.OldObject.Raw, oldCluster); err != nil {
+		return nil, err
+	}
+	oldErrs, err := checkDBClusterPolicy(req, oldCluster)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, e := range oldErrs {
+		existing[e.Error()] = true
+	}
+	added := field.ErrorList{}
+	for _, e := range errs {
+		if !existing[e.Error()] { // Same field, value & reason as before the update
+			added = append(added, e)
+		}
+	}
+	return added, nil
+
+}
+
+// checkDBClusterPolicy returns the violations of dbClusterPolicy by the DBCluster.
+func checkDBClusterPolicy(req *validationRequest, cluster *DBCluster) (field.ErrorList, error) {
+
+	p := dbClusterPolicy
+	specPath := field.NewPath("spec")
+	errs := field.ErrorList{}
+	if len(p.DatabaseVersions) != 0 && !containsString(p.DatabaseVersions, cluster.Spec.DatabaseVersion) {
+		errs = append(errs, field.NotSupported(specPath.Child("databaseVersion"), cluster.Spec.DatabaseVersion, p.DatabaseVersions))
+	}
+	resourcesPath := specPath.Child("primarySpec", "resources")
+	resources := cluster.Spec.PrimarySpec.Resources
+	errs = append(errs, p.CPU.check(resources.CPU, resourcesPath.Child("cpu"))...)
+	errs = append(errs, p.Memory.check(resources.Memory, resourcesPath.Child("memory"))...)
+	for i, disk := range resources.Disks {
+		diskPath := resourcesPath.Child("disks").Index(i)
+		size := disk.Size
+		errs = append(errs, p.Disk.check(&size, diskPath.Child("size"))...)
+		if len(p.StorageClasses) == 0 {
+			continue
+		}
+		if disk.StorageClass == "" {
+			errs = append(errs, field.Required(diskPath.Child("storageClass"), fmt.Sprintf("must be one of the approved storage classes %v", p.StorageClasses)))
+		} else if !containsString(p.StorageClasses, disk.StorageClass) {
+			errs = append(errs, field.NotSupported(diskPath.Child("storageClass"), disk.StorageClass, p.StorageClasses))
+		}
+	}
+	if p.Parameters != nil {
+		errs = append(errs, p.Parameters.check(cluster.Spec.PrimarySpec.Parameters, resources.Memory, specPath.Child("primarySpec", "parameters"))...)
+	}
+	if p.haRequired != nil && cluster.Spec.Availability.NumberOfStandbys < 1 {
+		ns, err := req.getNamespace()
+		if err != nil {
+			return nil, fmt.Errorf("could not look up the namespace %s for the HA requirement: %v", req.namespace, err)
+		}
+		if p.haRequired.Matches(labels.Set(ns.Labels)) {
+			errs = append(errs, field.Invalid(specPath.Child("availability", "numberOfStandbys"), cluster.Spec.Availability.NumberOfStandbys,
+				fmt.Sprintf("the namespace %s requires high availability, at least 1 standby", req.namespace)))
+		}
+	}
+	return errs, nil
+
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateDBCluster(t *testing.T) {
+	tests := []struct {
+		id         int
+		name       string
+		namespace  string
+		object     string
+		oldObject  string // Updated when set, created otherwise
+		allowed    bool
+		wantFields []string
+	}{
+		{
+			name:      "Compliant HA Cluster",
+			id:        0,
+			namespace: "prod",
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "17.5.0", "availability": {"numberOfStandbys": 1}, "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi", "disks": [{"name": "DataDisk", "size": "100Gi", "storageClass": "premium-rwo"}]}}}}`,
+			allowed:   true,
+		},
+		{
+			name:      "Out Of Policy Cluster",
+			id:        1,
+			namespace: "dev",
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "15.7.0", "primarySpec": {"resources": {"cpu": "500m", "memory": "1Ti", "disks": [{"name": "DataDisk", "size": "5Gi", "storageClass": "standard"}, {"name": "LogDisk", "size": "10Gi"}]}}}}`,
+			allowed:   false,
+			wantFields: []string{
+				"spec.databaseVersion",
+				"spec.primarySpec.resources.cpu",
+				"spec.primarySpec.resources.memory",
+				"spec.primarySpec.resources.disks[0].size",
+				"spec.primarySpec.resources.disks[0].storageClass",
+				"spec.primarySpec.resources.disks[1].storageClass",
+			},
+		},
+		{
+			name:       "No Standby In A Production Namespace",
+			id:         2,
+			namespace:  "prod",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "17.5.0", "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi"}}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.availability.numberOfStandbys"},
+		},
+		{
+			name:      "No Standby In A Development Namespace",
+			id:        3,
+			namespace: "dev",
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 2, "memory": "8Gi"}}}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Missing Resources",
+			id:         4,
+			namespace:  "dev",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0"}}`,
+			allowed:    false,
+			wantFields: []string{"spec.primarySpec.resources.cpu", "spec.primarySpec.resources.memory"},
+		},
+		{
+			name:       "Invalid Parameters",
+			id:         5,
+			namespace:  "dev",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 2, "memory": "8Gi"}, "parameters": {"fsync": "off", "shared_buffers": "8GB"}}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.primarySpec.parameters[fsync]", "spec.primarySpec.parameters[shared_buffers]"},
+		},
+		{
+			name:      "Metadata Update Of A Cluster Created Under A Looser Policy",
+			id:        6,
+			namespace: "dev",
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders", "labels": {"team": "payments"}}, "spec": {"databaseVersion": "15.7.0", "primarySpec": {"resources": {"cpu": "500m", "memory": "8Gi"}}}}`,
+			oldObject: `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "15.7.0", "primarySpec": {"resources": {"cpu": "500m", "memory": "8Gi"}}}}`,
+			allowed:   true,
+		},
+		{
+			name:      "Finalizer Removal From A Deleted Cluster",
+			id:        7,
+			namespace: "dev",
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders", "deletionTimestamp": "2026-10-17T12:00:00Z"}, "spec": {"databaseVersion": "15.7.0", "primarySpec": {"resources": {"cpu": "500m", "memory": "8Gi"}}}}`,
+			oldObject: `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders", "deletionTimestamp": "2026-10-17T12:00:00Z", "finalizers": ["alloydbomni.dbadmin.goog/finalizer"]}, "spec": {"databaseVersion": "15.7.0", "primarySpec": {"resources": {"cpu": "500m", "memory": "8Gi"}}}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Update Changing A Field Out Of Policy",
+			id:         8,
+			namespace:  "dev",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "15.7.0", "primarySpec": {"resources": {"cpu": "250m", "memory": "8Gi"}}}}`,
+			oldObject:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "15.7.0", "primarySpec": {"resources": {"cpu": "500m", "memory": "8Gi"}}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.primarySpec.resources.cpu"},
+		},
+	}
+
+	setTestDBClusterPolicy(t)
+	admit := validatingRoutes["/validate/dbcluster"]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      "orders",
+					Namespace: tt.namespace,
+					Operation: v1beta1.Create,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+				},
+			}
+			if tt.oldObject != "" {
+				ar.Request.Operation = v1beta1.Update
+				ar.Request.OldObject = runtime.RawExtension{Raw: []byte(tt.oldObject)}
+			}
+			got := admit(ar, nil)
+
+			if got.Allowed != tt.allowed {
+				t.Fatalf("\t%s\tTest ID=%d::Got allowed %t, want %t:: %+v", failed, tt.id, got.Allowed, tt.allowed, got.Result)
+			}
+			if tt.allowed {
+				return
+			}
+			if got.Result.Reason != metav1.StatusReasonInvalid || got.Result.Details == nil {
+				t.Fatalf("\t%s\tTest ID=%d::Got result %+v, want an Invalid status with details", failed, tt.id, got.Result)
+			}
+			fields := []string{}
+			for _, cause := range got.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %s", failed, tt.id, fields, tt.wantFields, got.Result.Message)
+			}
+		})
+	}
+}
+
+func TestValidateDBClusterChecks(t *testing.T) {
+	const old = `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 2, "memory": "8Gi", "disks": [{"name": "DataDisk", "size": "100Gi", "storageClass": "premium-rwo"}]}}}}`
+	const object = `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 4, "memory": "8Gi", "disks": [{"name": "DataDisk", "size": "100Gi", "storageClass": "standard"}]}}}}`
+	want := []string{
+		"spec.primarySpec.resources.disks[0].storageClass", // Out of the DBCluster policy
+		"spec.primarySpec.resources.cpu",                   // Guarded by the update policy
+		"spec.primarySpec.resources.disks[0].storageClass",
+	}
+
+	setTestAuditLog(t)
+	setTestDBClusterPolicy(t)
+	setTestDBClusterUpdatePolicy(t)
+	ar := &v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+			Name:      "orders",
+			Namespace: "dev",
+			Operation: v1beta1.Update,
+			Object:    runtime.RawExtension{Raw: []byte(object)},
+			OldObject: runtime.RawExtension{Raw: []byte(old)},
+		},
+	}
+	got := validatingRoutes["/validate/dbcluster"](ar, nil)
+
+	if got.Allowed || got.Result.Details == nil {
+		t.Fatalf("\t%s\tGot allowed %t, want a denial by both checks:: %+v", failed, got.Allowed, got.Result)
+	}
+	fields := []string{}
+	for _, cause := range got.Result.Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("\t%s\tGot denied fields %v, want %v:: %s", failed, fields, want, got.Result.Message)
+	}
+}
+
+func TestLoadDBClusterPolicy(t *testing.T) {
+	data := "cpu:\n  min: 8\n  max: 2\nhaRequiredNamespaceSelector:\n  matchLabels:\n    env: production\n"
+	want := "line 3, column 3: cpu.max: Invalid value: \"2\": must not be less than min 8"
+
+	if _, err := loadDBClusterPolicy([]byte(data)); err == nil || err.Error() != want {
+		t.Errorf("\t%s\tGot error %v, want %s", failed, err, want)
+	}
+}
+
+// setTestDBClusterPolicy serves the validator with a policy requiring HA in the namespaces labelled env=production &
+// denying fsync=off.
+func setTestDBClusterPolicy(t *testing.T) {
+
+	policy, err := loadDBClusterPolicy([]byte(`
+databaseVersions: ["16.8.0", "17.5.0"]
+cpu: {min: 1, max: 16}
+memory: {min: 4Gi, max: 128Gi}
+disk: {min: 10Gi, max: 2Ti}
+storageClasses: [premium-rwo]
+haRequiredNamespaceSelector:
+  matchLabels:
+    env: production
+parameters:
+  denied:
+    fsync: ["off"]
+`))
+	if err != nil {
+		t.Fatalf("\t%s\tCould not load the DBCluster policy:: %v", failed, err)
+	}
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "production"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"env": "development"}}},
+	)
+	savedPolicy, savedNamespaces := dbClusterPolicy, namespaces
+	dbClusterPolicy, namespaces = policy, startTestNamespaceInformer(t, client)
+	setTestDBClusterCheck(t, "dbcluster-policy", validateDBCluster)
+	t.Cleanup(func() {
+		dbClusterPolicy, namespaces = savedPolicy, savedNamespaces
+	})
+}
+
+// setTestDBClusterCheck adds the check to /validate/dbcluster until the test ends.
+func setTestDBClusterCheck(t *testing.T, name string, check validator) {
+
+	savedChecks, savedRoute := dbClusterChecks, validatingRoutes["/validate/dbcluster"]
+	registerDBClusterCheck(name, check)
+	t.Cleanup(func() {
+		dbClusterChecks = savedChecks
+		if savedRoute == nil {
+			delete(validatingRoutes, "/validate/dbcluster")
+		} else {
+			validatingRoutes["/validate/dbcluster"] = savedRoute
+		}
+	})
+
+}
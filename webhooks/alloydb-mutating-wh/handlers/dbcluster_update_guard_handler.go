@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// The changes a GuardedField denies.
+const (
+	immutableChange  = "immutable"   // Any change, setting or removing the field included
+	noDecreaseChange = "no-decrease" // Lowering a quantity or removing it
+)
+
+// GuardedField is a field of the DBClusters that an update must not change, Path is a field path like
+// spec.primarySpec.resources.disks[*].size where [*] stands for each item of a list.
+type GuardedField struct {
+	Path   string `json:"path"`
+	Change string `json:"change,omitempty"` // immutable (default) or no-decrease
+	Reason string `json:"reason,omitempty"` // Told in the denial, like "the operator recreates the disk"
+
+	segments []guardedSegment
+}
+
+type guardedSegment struct {
+	name string
+	each bool // Followed by [*]
+}
+
+// DBClusterUpdatePolicy is the layout of the file pointed to by DBCLUSTER_UPDATE_POLICY_CONFIG_PATH &
+// DBCLUSTER_UPDATE_POLICY_CONFIG_FILE.
+type DBClusterUpdatePolicy struct {
+	Fields []GuardedField `json:"fields"`
+}
+
+var guardedSegmentSyntax = regexp.MustCompile(`^[A-Za-z0-9_-]+(\[\*\])?$`)
+
+var dbClusterUpdatePolicy *DBClusterUpdatePolicy
+
+// BuildDBClusterUpdatePolicy loads the guarded fields & checks the updates of the DBClusters against them at
+// /validate/dbcluster when DBCLUSTER_UPDATE_POLICY_CONFIG_FILE is set.
+func BuildDBClusterUpdatePolicy() {
+	fileName := os.Getenv("DBCLUSTER_UPDATE_POLICY_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("DBCLUSTER_UPDATE_POLICY_CONFIG_PATH"), fileName)
+	registerDBClusterCheck("dbcluster-update-policy", validateDBClusterUpdate, "dbcluster-update-policy")
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("dbcluster-update-policy", "handlers.BuildDBClusterUpdatePolicy():Error opening DBCluster update policy config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("dbcluster-update-policy", "handlers.BuildDBClusterUpdatePolicy():Error reading the DBCluster update policy from the file:: %v", err)
+		return
+	}
+	if dbClusterUpdatePolicy, err = loadDBClusterUpdatePolicy(data); err != nil {
+		configFailed("dbcluster-update-policy", "handlers.BuildDBClusterUpdatePolicy():Error loading the DBCluster update policy from the file %s:: %v", filePath, err)
+		return
+	}
+	configLoaded("dbcluster-update-policy", filePath, data)
+	log.Info("handlers.BuildDBClusterUpdatePolicy():Enabled the DBCluster update validation")
+
+}
+
+func loadDBClusterUpdatePolicy(data []byte) (*DBClusterUpdatePolicy, error) {
+
+	policy := &DBClusterUpdatePolicy{}
+	if err := loadConfig(data, policy, policy.validate); err != nil {
+		return nil, err
+	}
+	return policy, nil
+
+}
+
+// validate checks the guarded fields & splits their paths into segments.
+func (p *DBClusterUpdatePolicy) validate() field.ErrorList {
+
+	errs := field.ErrorList{}
+	if len(p.Fields) == 0 {
+		errs = append(errs, field.Required(field.NewPath("fields"), "at least one field to guard"))
+	}
+	for i := range p.Fields {
+		f := &p.Fields[i]
+		idxPath := field.NewPath("fields").Index(i)
+		switch f.Change {
+		case "":
+			f.Change = immutableChange
+		case immutableChange, noDecreaseChange:
+		default:
+			errs = append(errs, field.NotSupported(idxPath.Child("change"), f.Change, []string{immutableChange, noDecreaseChange}))
+		}
+		f.segments = nil
+		for _, segment := range strings.Split(f.Path, ".") {
+			if !guardedSegmentSyntax.MatchString(segment) {
+				errs = append(errs, field.Invalid(idxPath.Child("path"), f.Path, "must be a field path like spec.primarySpec.resources.disks[*].size"))
+				break
+			}
+			name, each := strings.CutSuffix(segment, "[*]")
+			f.segments = append(f.segments, guardedSegment{name: name, each: each})
+		}
+	}
+	return errs
+
+}
+
+// validateDBClusterUpdate denies the updates changing a guarded field of the DBCluster, each change is reported at its
+// path with the old & the new value. Setting breakGlassAnnotation to a new reason in the same update lets them through,
+// one left over from an earlier update doesn't.
+func validateDBClusterUpdate(req *validationRequest) (field.ErrorList, error) {
+
+	if req.ar.Request.Operation != v1beta1.Update || len(req.ar.Request.OldObject.Raw) == 0 {
+		return nil, nil
+	}
+	newCluster, err := decodeUnstructured(req.ar.Request.Object.Raw)
+	if err != nil {
+		return nil, err
+	}
+	oldCluster, err := decodeUnstructured(req.ar.Request.OldObject.Raw)
+	if err != nil {
+		return nil, err
+	}
+	errs := field.ErrorList{}
+	for _, f := range dbClusterUpdatePolicy.Fields {
+		errs = append(errs, f.diff(oldCluster, newCluster, f.segments, nil)...)
+	}
+	if len(errs) == 0 {
+		return nil, nil
+	}
+
+	reason := breakGlassReason(newCluster)
+	if reason == "" || reason == breakGlassReason(oldCluster) {
+		audit(req, "dbcluster-update-guard", dbClusterKind.Kind, false, errs.ToAggregate().Error())
+		return errs, nil
+	}
+	log.Warningf("handlers.validateDBClusterUpdate():Break-glass update of the guarded fields of the DBCluster %s/%s by %s:: %s",
+		req.namespace, req.ar.Request.Name, req.ar.Request.UserInfo.Username, reason)
+	for _, e := range errs {
+		req.warn("changing %s with %s: %s", e.Field, breakGlassAnnotation, e.Detail)
+	}
+	audit(req, "dbcluster-update-guard", dbClusterKind.Kind, true, fmt.Sprintf("%s: %s", breakGlassAnnotation, reason))
+	return nil, nil
+
+}
+
+// diff follows the segments down the old & the new object in step & returns the changes the field denies, the items
+// of a list are paired by their name when they have one & by their index otherwise.
+func (f GuardedField) diff(oldValue, newValue interface{}, segments []guardedSegment, fldPath *field.Path) field.ErrorList {
+
+	if len(segments) == 0 {
+		return f.check(oldValue, newValue, fldPath)
+	}
+	segment := segments[0]
+	oldValue, newValue = childValue(oldValue, segment.name), childValue(newValue, segment.name)
+	if fldPath == nil {
+		fldPath = field.NewPath(segment.name)
+	} else {
+		fldPath = fldPath.Child(segment.name)
+	}
+	if !segment.each {
+		return f.diff(oldValue, newValue, segments[1:], fldPath)
+	}
+
+	oldItems, _ := oldValue.([]interface{})
+	newItems, _ := newValue.([]interface{})
+	errs := field.ErrorList{}
+	if oldNames, newNames := itemNames(oldItems), itemNames(newItems); oldNames != nil && newNames != nil {
+		oldIndex, newIndex := map[string]int{}, map[string]int{}
+		for j, name := range oldNames {
+			oldIndex[name] = j
+		}
+		for i, name := range newNames {
+			newIndex[name] = i
+			var oldItem interface{}
+			if j, ok := oldIndex[name]; ok {
+				oldItem = oldItems[j]
+			}
+			errs = append(errs, f.diff(oldItem, newItems[i], segments[1:], fldPath.Index(i))...)
+		}
+		for j, name := range oldNames {
+			if _, ok := newIndex[name]; !ok {
+				errs = append(errs, f.diff(oldItems[j], nil, segments[1:], fldPath.Index(j))...) // Removed
+			}
+		}
+		return errs
+	}
+	for i := 0; i < len(oldItems) || i < len(newItems); i++ {
+		var oldItem, newItem interface{}
+		if i < len(oldItems) {
+			oldItem = oldItems[i]
+		}
+		if i < len(newItems) {
+			newItem = newItems[i]
+		}
+		errs = append(errs, f.diff(oldItem, newItem, segments[1:], fldPath.Index(i))...)
+	}
+	return errs
+
+}
+
+// check compares the old & the new value of the field, nil when it isn't set.
+func (f GuardedField) check(oldValue, newValue interface{}, fldPath *field.Path) field.ErrorList {
+
+	if sameValue(oldValue, newValue) {
+		return nil
+	}
+	reason := f.Reason
+	switch f.Change {
+	case noDecreaseChange:
+		if oldValue == nil {
+			return nil
+		}
+		if newValue != nil {
+			oldQuantity, oldErr := resource.ParseQuantity(jsonScalar(oldValue))
+			newQuantity, newErr := resource.ParseQuantity(jsonScalar(newValue))
+			if oldErr != nil || newErr != nil {
+				return field.ErrorList{field.Invalid(fldPath, jsonScalar(newValue), "must be a quantity")}
+			}
+			if newQuantity.Cmp(oldQuantity) >= 0 {
+				return nil
+			}
+		}
+		if reason == "" {
+			reason = "must not decrease"
+		}
+	default:
+		if reason == "" {
+			reason = "is immutable"
+		}
+	}
+	return field.ErrorList{field.Forbidden(fldPath, fmt.Sprintf("%s (%s -> %s), set the annotation %s to the reason to change it anyway",
+		reason, jsonScalar(oldValue), jsonScalar(newValue), breakGlassAnnotation))}
+
+}
+
+// sameValue compares the values of a field down to their scalars, the scalars written as equal quantities like 2 & "2"
+// or 1Gi & 1024Mi are the same.
+func sameValue(oldValue, newValue interface{}) bool {
+
+	switch o := oldValue.(type) {
+	case map[string]interface{}:
+		n, ok := newValue.(map[string]interface{})
+		if !ok || len(o) != len(n) {
+			return false
+		}
+		for k, v := range o {
+			if nv, ok := n[k]; !ok || !sameValue(v, nv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		n, ok := newValue.([]interface{})
+		if !ok || len(o) != len(n) {
+			return false
+		}
+		for i := range o {
+			if !sameValue(o[i], n[i]) {
+				return false
+			}
+		}
+		return true
+	case string, json.Number:
+		if reflect.DeepEqual(oldValue, newValue) {
+			return true
+		}
+		switch newValue.(type) {
+		case string, json.Number:
+		default:
+			return false
+		}
+		oldQuantity, oldErr := resource.ParseQuantity(jsonScalar(oldValue))
+		newQuantity, newErr := resource.ParseQuantity(jsonScalar(newValue))
+		return oldErr == nil && newErr == nil && oldQuantity.Cmp(newQuantity) == 0
+	}
+	return reflect.DeepEqual(oldValue, newValue)
+
+}
+
+// decodeUnstructured decodes a resource keeping its numbers as written so that they compare as quantities.
+func decodeUnstructured(raw []byte) (map[string]interface{}, error) {
+
+	obj := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+
+}
+
+func childValue(value interface{}, name string) interface{} {
+	if m, ok := value.(map[string]interface{}); ok {
+		return m[name]
+	}
+	return nil
+}
+
+// jsonScalar formats a value of the field for a message, <unset> when it's missing.
+func jsonScalar(value interface{}) string {
+
+	switch v := value.(type) {
+	case nil:
+		return "<unset>"
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+
+}
+
+// itemNames returns the names of the items of a list, nil unless every item has a distinct name.
+func itemNames(items []interface{}) []string {
+
+	names, seen := make([]string, 0, len(items)), map[string]bool{}
+	for _, item := range items {
+		name, ok := childValue(item, "name").(string)
+		if !ok || name == "" || seen[name] {
+			return nil
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+
+}
+
+func breakGlassReason(obj map[string]interface{}) string {
+	reason, _ := childValue(childValue(childValue(obj, "metadata"), "annotations"), breakGlassAnnotation).(string)
+	return reason
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestLoadDBClusterUpdatePolicy(t *testing.T) {
+	tests := []struct {
+		id      int
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:   "Valid Policy",
+			id:     0,
+			config: "fields:\n- path: spec.primarySpec.resources.disks[*].storageClass\n- path: spec.primarySpec.resources.disks[*].size\n  change: no-decrease\n",
+		},
+		{
+			name:    "No Fields",
+			id:      1,
+			config:  "fields: []\n",
+			wantErr: "fields: Required value",
+		},
+		{
+			name:    "Invalid Path",
+			id:      2,
+			config:  "fields:\n- path: spec.primarySpec.resources.disks[0].size\n",
+			wantErr: "line 2, column 3: fields[0].path",
+		},
+		{
+			name:    "Unknown Change",
+			id:      3,
+			config:  "fields:\n- path: spec.databaseVersion\n  change: no-downgrade\n",
+			wantErr: "line 3, column 3: fields[0].change",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadDBClusterUpdatePolicy([]byte(tt.config))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("\t%s\tTest ID=%d::Could not load the DBCluster update policy:: %v", failed, tt.id, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("\t%s\tTest ID=%d::Got the error %v, want one about %s", failed, tt.id, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDBClusterUpdate(t *testing.T) {
+	const old = `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi", "disks": [{"name": "DataDisk", "size": "100Gi", "storageClass": "premium-rwo"}, {"name": "LogDisk", "size": "10Gi", "storageClass": "premium-rwo"}]}}}}`
+	tests := []struct {
+		id           int
+		name         string
+		operation    v1beta1.Operation
+		object       string
+		oldObject    string
+		allowed      bool
+		wantFields   []string
+		wantMessage  string
+		wantWarnings int
+	}{
+		{
+			name:      "Unguarded Change",
+			id:        0,
+			operation: v1beta1.Update,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.9.0", "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi", "disks": [{"name": "DataDisk", "size": "100Gi", "storageClass": "premium-rwo"}, {"name": "LogDisk", "size": "10Gi", "storageClass": "premium-rwo"}]}}}}`,
+			oldObject: old,
+			allowed:   true,
+		},
+		{
+			name:        "Storage Class Change",
+			id:          1,
+			operation:   v1beta1.Update,
+			object:      `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi", "disks": [{"name": "DataDisk", "size": "100Gi", "storageClass": "standard-rwo"}, {"name": "LogDisk", "size": "10Gi", "storageClass": "premium-rwo"}]}}}}`,
+			oldObject:   old,
+			allowed:     false,
+			wantFields:  []string{"spec.primarySpec.resources.disks[0].storageClass"},
+			wantMessage: "the operator recreates the disk (premium-rwo -> standard-rwo)",
+		},
+		{
+			name:        "Shrunk Disk",
+			id:          2,
+			operation:   v1beta1.Update,
+			object:      `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi", "disks": [{"name": "DataDisk", "size": "50Gi", "storageClass": "premium-rwo"}, {"name": "LogDisk", "size": "10Gi", "storageClass": "premium-rwo"}]}}}}`,
+			oldObject:   old,
+			allowed:     false,
+			wantFields:  []string{"spec.primarySpec.resources.disks[0].size"},
+			wantMessage: "must not decrease (100Gi -> 50Gi)",
+		},
+		{
+			name:      "Reordered & Grown Disks",
+			id:        3,
+			operation: v1beta1.Update,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi", "disks": [{"name": "LogDisk", "size": "20Gi", "storageClass": "premium-rwo"}, {"name": "DataDisk", "size": "0.5Ti", "storageClass": "premium-rwo"}]}}}}`,
+			oldObject: old,
+			allowed:   true,
+		},
+		{
+			name:       "Removed Disk",
+			id:         4,
+			operation:  v1beta1.Update,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi", "disks": [{"name": "DataDisk", "size": "100Gi", "storageClass": "premium-rwo"}]}}}}`,
+			oldObject:  old,
+			allowed:    false,
+			wantFields: []string{"spec.primarySpec.resources.disks[1].storageClass", "spec.primarySpec.resources.disks[1].size"},
+		},
+		{
+			name:         "Break Glass",
+			id:           5,
+			operation:    v1beta1.Update,
+			object:       `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders", "annotations": {"alloydb.cloud.google.com/break-glass": "CHG-1234 move to the new storage class"}}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi", "disks": [{"name": "DataDisk", "size": "100Gi", "storageClass": "standard-rwo"}, {"name": "LogDisk", "size": "10Gi", "storageClass": "standard-rwo"}]}}}}`,
+			oldObject:    old,
+			allowed:      true,
+			wantWarnings: 2,
+		},
+		{
+			name:        "Break Glass Left Over",
+			id:          6,
+			operation:   v1beta1.Update,
+			object:      `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders", "annotations": {"alloydb.cloud.google.com/break-glass": "CHG-1234"}}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi", "disks": [{"name": "DataDisk", "size": "90Gi"}]}}}}`,
+			oldObject:   `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders", "annotations": {"alloydb.cloud.google.com/break-glass": "CHG-1234"}}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": 4, "memory": "16Gi", "disks": [{"name": "DataDisk", "size": "100Gi"}]}}}}`,
+			allowed:     false,
+			wantFields:  []string{"spec.primarySpec.resources.disks[0].size"},
+			wantMessage: "set the annotation alloydb.cloud.google.com/break-glass to the reason",
+		},
+		{
+			name:      "Creation",
+			id:        7,
+			operation: v1beta1.Create,
+			object:    old,
+			allowed:   true,
+		},
+		{
+			name:      "Same Quantities",
+			id:        8,
+			operation: v1beta1.Update,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": "4", "memory": "16384Mi", "disks": [{"name": "DataDisk", "size": "102400Mi", "storageClass": "premium-rwo"}, {"name": "LogDisk", "size": "10Gi", "storageClass": "premium-rwo"}]}}}}`,
+			oldObject: old,
+			allowed:   true,
+		},
+		{
+			name:        "CPU Change",
+			id:          9,
+			operation:   v1beta1.Update,
+			object:      `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "orders"}, "spec": {"databaseVersion": "16.8.0", "primarySpec": {"resources": {"cpu": "4500m", "memory": "16Gi", "disks": [{"name": "DataDisk", "size": "100Gi", "storageClass": "premium-rwo"}, {"name": "LogDisk", "size": "10Gi", "storageClass": "premium-rwo"}]}}}}`,
+			oldObject:   old,
+			allowed:     false,
+			wantFields:  []string{"spec.primarySpec.resources.cpu"},
+			wantMessage: "is immutable (4 -> 4500m)",
+		},
+	}
+
+	buf := setTestAuditLog(t)
+	setTestDBClusterUpdatePolicy(t)
+	admit := validatingRoutes["/validate/dbcluster"]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      "orders",
+					Namespace: "db",
+					Operation: tt.operation,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+					OldObject: runtime.RawExtension{Raw: []byte(tt.oldObject)},
+				},
+			}
+			got := admit(ar, nil)
+
+			if got.Allowed != tt.allowed {
+				t.Fatalf("\t%s\tTest ID=%d::Got allowed %t, want %t:: %+v", failed, tt.id, got.Allowed, tt.allowed, got.Result)
+			}
+			if len(got.Warnings) != tt.wantWarnings {
+				t.Errorf("\t%s\tTest ID=%d::Got the warnings %v, want %d", failed, tt.id, got.Warnings, tt.wantWarnings)
+			}
+			wantAudit := 0
+			if !tt.allowed || tt.wantWarnings != 0 {
+				wantAudit = 1 // Only the guarded changes are audited
+			}
+			if events := decodeTestAuditLog(t, buf); len(events) != wantAudit {
+				t.Errorf("\t%s\tTest ID=%d::Got the audit events %+v, want %d", failed, tt.id, events, wantAudit)
+			}
+			if tt.allowed {
+				return
+			}
+			fields := []string{}
+			for _, cause := range got.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %s", failed, tt.id, fields, tt.wantFields, got.Result.Message)
+			}
+			if !strings.Contains(got.Result.Message, tt.wantMessage) {
+				t.Errorf("\t%s\tTest ID=%d::Got the message %q, want it to contain %q", failed, tt.id, got.Result.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+// setTestDBClusterUpdatePolicy makes the cpu, memory & storage class of the disks immutable & their size grow only.
+func setTestDBClusterUpdatePolicy(t *testing.T) {
+
+	policy, err := loadDBClusterUpdatePolicy([]byte(`
+fields:
+- path: spec.primarySpec.resources.cpu
+- path: spec.primarySpec.resources.memory
+- path: spec.primarySpec.resources.disks[*].storageClass
+  reason: the operator recreates the disk
+- path: spec.primarySpec.resources.disks[*].size
+  change: no-decrease
+`))
+	if err != nil {
+		t.Fatalf("\t%s\tCould not load the DBCluster update policy:: %v", failed, err)
+	}
+	savedPolicy := dbClusterUpdatePolicy
+	dbClusterUpdatePolicy = policy
+	setTestDBClusterCheck(t, "dbcluster-update-policy", validateDBClusterUpdate)
+	t.Cleanup(func() {
+		dbClusterUpdatePolicy = savedPolicy
+	})
+
+}
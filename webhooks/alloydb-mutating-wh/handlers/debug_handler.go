@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	log "k8s.io/klog/v2"
+)
+
+// configHashAnnotation is stamped on the pods the webhook mutated with the hash of the config that placed them.
+const configHashAnnotation = "alloydb.cloud.google.com/config-hash"
+
+// ConfigSource is a config file the webhook loaded at start up.
+type ConfigSource struct {
+	Kind     string    `json:"kind"` // One of ConfigKinds()
+	Path     string    `json:"path"`
+	LoadedAt time.Time `json:"loadedAt"`
+	SHA256   string    `json:"sha256"`
+}
+
+// EffectiveConfig is what /debug/config returns, the config as the webhook parsed it & applies it.
+type EffectiveConfig struct {
+	ConfigHash                string                               `json:"configHash"`
+	Sources                   []ConfigSource                       `json:"sources"`
+	ConfigErrors              []string                             `json:"configErrors,omitempty"`
+	FailureMode               FailureMode                          `json:"failureMode"`
+	MutationMode              MutationMode                         `json:"mutationMode"`
+	DryRunMutators            []string                             `json:"dryRunMutators,omitempty"`
+	Tolerations               []corev1.Toleration                  `json:"tolerations"`
+	NodeSelectors             map[string]string                    `json:"nodeSelectors,omitempty"`
+	RolePlacements            map[string]RolePlacement             `json:"rolePlacements,omitempty"`
+	FailoverTolerationSeconds map[string]FailoverTolerationSeconds `json:"failoverTolerationSeconds,omitempty"`
+	Rules                     PodRules                             `json:"rules"`
+	Allowlist                 Allowlist                            `json:"allowlist"`
+	NamespaceBounds           *NamespaceBounds                     `json:"namespaceBounds,omitempty"`
+	PlacementPolicies         map[string]string                    `json:"placementPolicies,omitempty"` // namespace/name to "Valid" or the error
+}
+
+var configSources []ConfigSource // Written by the Build functions at start up only
+
+var debugToken string // Bearer token /debug/config is served to, the endpoint is off when empty
+
+// configLoaded records a config file the Build functions loaded.
+func configLoaded(kind, filePath string, data []byte) {
+
+	sum := sha256.Sum256(data)
+	configSources = append(configSources, ConfigSource{Kind: kind, Path: filePath, LoadedAt: time.Now().UTC(), SHA256: hex.EncodeToString(sum[:])})
+
+}
+
+// podConfigHash hashes what the pods are mutated with: the files of the podConfigs, the failure, mutation & dry-run
+// modes, the enabled mutators (OpenShift's included) & the generations of the valid PlacementPolicies. The configs of
+// the validators are left out, the hash is empty until a pod config is loaded.
+func podConfigHash() string {
+
+	lines := []string{}
+	for _, s := range configSources {
+		if containsString(podConfigs, s.Kind) {
+			lines = append(lines, s.Kind+" "+s.SHA256)
+		}
+	}
+	if placementPolicies != nil {
+		lines = append(lines, placementPolicies.generations()...)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	mutators := make([]string, 0, len(podMutators))
+	for _, m := range podMutators {
+		mutators = append(mutators, m.name)
+	}
+	dryRun := append([]string{}, dryRunMutators...)
+	sort.Strings(dryRun)
+	lines = append(lines, "failure-mode "+string(failureMode), "mutation-mode "+string(mutationMode),
+		"dry-run "+strings.Join(dryRun, ","), "mutators "+strings.Join(mutators, ","))
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])[:16]
+
+}
+
+// BuildDebug loads the token of the /debug/config endpoint when DEBUG_TOKEN_FILE is set, the endpoint isn't served otherwise.
+func BuildDebug() {
+	fileName := os.Getenv("DEBUG_TOKEN_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("DEBUG_TOKEN_PATH"), fileName)
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("debug", "handlers.BuildDebug():Error opening debug token file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("debug", "handlers.BuildDebug():Error reading the debug token from the file:: %v", err)
+		return
+	}
+	if debugToken = strings.TrimSpace(string(data)); debugToken == "" {
+		configFailed("debug", "handlers.BuildDebug():The debug token file %s is empty", filePath)
+		return
+	}
+	log.Info("handlers.BuildDebug():Enabled the /debug/config endpoint")
+
+}
+
+// serveDebugConfig returns the EffectiveConfig to the clients presenting the debug token.
+func serveDebugConfig(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Only GET requests are accepted, received: %s", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || debugToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(debugToken)) != 1 {
+		log.Warningf("handlers.serveDebugConfig():Refused an unauthenticated request from %s", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	config := EffectiveConfig{
+		ConfigHash:                podConfigHash(),
+		Sources:                   configSources,
+		ConfigErrors:              configErrors,
+		FailureMode:               failureMode,
+		MutationMode:              mutationMode,
+		DryRunMutators:            dryRunMutators,
+		Tolerations:               tolerations,
+		NodeSelectors:             nodeSelectors,
+		RolePlacements:            rolePlacements,
+		FailoverTolerationSeconds: failoverTolerationSeconds,
+		Rules:                     podRules,
+		Allowlist:                 allowlist,
+		NamespaceBounds:           namespaceBounds,
+	}
+	if placementPolicies != nil {
+		config.PlacementPolicies = placementPolicies.states()
+	}
+	resp, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		log.Errorf("handlers.serveDebugConfig():Error marshalling the effective config:: %v", err)
+		http.Error(w, fmt.Sprintf("Error marshalling the effective config:: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(resp); err != nil {
+		log.Errorf("handlers.serveDebugConfig():Error writing the effective config back to the client:: %v", err)
+	}
+
+}
+
+// configHashPatch stamps configHashAnnotation on the pod.
+func configHashPatch(pod *corev1.Pod) []patchOperation {
+
+	configHash := podConfigHash()
+	if configHash == "" {
+		return nil
+	}
+	if pod.Annotations == nil {
+		return []patchOperation{{Op: "add", Path: "/metadata/annotations", Value: map[string]string{configHashAnnotation: configHash}}}
+	}
+	return []patchOperation{{Op: "add", Path: "/metadata/annotations/" + strings.ReplaceAll(configHashAnnotation, "/", "~1"), Value: configHash}}
+
+}
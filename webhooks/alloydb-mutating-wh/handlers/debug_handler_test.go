@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestServeDebugConfig(t *testing.T) {
+	tests := []struct {
+		id            int
+		name          string
+		authorization string
+		want          int
+	}{
+		{
+			name: "No Token",
+			id:   0,
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:          "Wrong Token",
+			id:            1,
+			authorization: "Bearer not-the-token",
+			want:          http.StatusUnauthorized,
+		},
+		{
+			name:          "Valid Token",
+			id:            2,
+			authorization: "Bearer s3cr3t",
+			want:          http.StatusOK,
+		},
+	}
+
+	setTestDebug(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/config", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			serveDebugConfig(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("\t%s\tTest ID=%d::Got status %d, want %d", failed, tt.id, rec.Code, tt.want)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			got := EffectiveConfig{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("\t%s\tTest ID=%d::Could not unmarshal the effective config:: %v", failed, tt.id, err)
+			}
+			if want := podConfigHash(); got.ConfigHash != want || len(got.Sources) != 1 || got.Sources[0].Path != "/etc/tolerations/tolerations" {
+				t.Errorf("\t%s\tTest ID=%d::Got hash %s & sources %+v, want hash %s from /etc/tolerations/tolerations", failed, tt.id, got.ConfigHash, got.Sources, want)
+			}
+			if !reflect.DeepEqual(got.Tolerations, tolerations) {
+				t.Errorf("\t%s\tTest ID=%d::Got tolerations %+v, want %+v", failed, tt.id, got.Tolerations, tolerations)
+			}
+		})
+	}
+}
+
+func TestPodConfigHash(t *testing.T) {
+	tests := []struct {
+		id      int
+		name    string
+		set     func(t *testing.T)
+		changed bool
+	}{
+		{
+			name: "Validator Config",
+			id:   0,
+			set: func(t *testing.T) {
+				saved := configSources
+				configLoaded("dbcluster-policy", "/etc/dbcluster-policy/dbcluster-policy", []byte(`{"cpu": {"min": 2}}`))
+				t.Cleanup(func() { configSources = saved })
+			},
+			changed: false,
+		},
+		{
+			name:    "Failure Mode",
+			id:      1,
+			set:     func(t *testing.T) { setTestFailureMode(t, FailureModeOpen) },
+			changed: true,
+		},
+		{
+			name:    "Mutation Mode",
+			id:      2,
+			set:     func(t *testing.T) { setTestAnnotations(t, MutationModeOptIn) },
+			changed: true,
+		},
+		{
+			name: "Dry Run",
+			id:   3,
+			set: func(t *testing.T) {
+				saved := dryRunMutators
+				dryRunMutators = []string{tolerationsMutator}
+				t.Cleanup(func() { dryRunMutators = saved })
+			},
+			changed: true,
+		},
+		{
+			name:    "OpenShift Mode",
+			id:      4,
+			set:     setTestOpenShiftMode,
+			changed: true,
+		},
+		{
+			name:    "Placement Policies",
+			id:      5,
+			set:     func(t *testing.T) { setTestPlacementPolicies(t) },
+			changed: true,
+		},
+	}
+
+	setTestDebug(t)
+	base := podConfigHash()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.set(t)
+			got := podConfigHash()
+
+			if (got != base) != tt.changed {
+				t.Errorf("\t%s\tTest ID=%d::Got hash %s from %s, want changed %t", failed, tt.id, got, base, tt.changed)
+			}
+		})
+	}
+
+	configSources = []ConfigSource{{Kind: "dbcluster-policy", Path: "/etc/dbcluster-policy/dbcluster-policy", SHA256: base}}
+	if got := podConfigHash(); got != "" {
+		t.Errorf("\t%s\tGot hash %s without a pod config, want none", failed, got)
+	}
+}
+
+func TestMutatePodConfigHash(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		ar   *v1beta1.AdmissionReview
+		want *v1beta1.AdmissionResponse
+	}{
+		{
+			name: "Pod Without Annotations",
+			id:   0,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/metadata/annotations","value":{"alloydb.cloud.google.com/config-hash":"34b10ccb819a9258"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Pod With Annotations",
+			id:   1,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "annotations": {"team": "dba"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/metadata/annotations/alloydb.cloud.google.com~1config-hash","value":"34b10ccb819a9258"}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+	}
+
+	setTestDebug(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mutatePod(tt.ar, tolerations)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+// setTestDebug loads the test tolerations as if read from /etc/tolerations/tolerations & sets the debug token.
+func setTestDebug(t *testing.T) {
+
+	savedSources, savedToken := configSources, debugToken
+	configSources, debugToken = nil, "s3cr3t"
+	configLoaded("tolerations", "/etc/tolerations/tolerations", []byte(`[{"key": "cloud.google.com/alloydb-host", "operator": "Exists", "effect": "NoSchedule"}]`))
+	t.Cleanup(func() {
+		configSources, debugToken = savedSources, savedToken
+	})
+}
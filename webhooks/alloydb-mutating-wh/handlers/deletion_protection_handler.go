@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// confirmDeleteAnnotation must be set to the name of a protected resource followed by the time it was set, like
+// "prod 2026-10-17T12:00:00Z", to delete it. The confirmation expires after confirmationTTL so one left on a resource
+// whose deletion didn't go through can't let a later one through.
+const confirmDeleteAnnotation = "alloydb.cloud.google.com/confirm-delete"
+
+var confirmationTTL = 10 * time.Minute
+
+// confirmationSkew is how far in the future a confirmation may be set, for the clocks of the clients running ahead.
+const confirmationSkew = time.Minute
+
+// BuildDeletionProtection serves the DELETE validators of the DBClusters, BackupPlans & Backups at
+// /validate/delete/dbcluster, /validate/delete/backupplan & /validate/delete/backup when DELETION_PROTECTION is set to
+// true, DELETION_CONFIRMATION_TTL sets how long a confirmation is valid for.
+func BuildDeletionProtection() {
+	value := os.Getenv("DELETION_PROTECTION")
+	if value == "" {
+		return
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		configFailed("deletion-protection", "handlers.BuildDeletionProtection():Invalid value %q for DELETION_PROTECTION:: %v", value, err)
+		return
+	}
+	if !enabled {
+		return
+	}
+	registerDeletionProtection()
+	if ttl := os.Getenv("DELETION_CONFIRMATION_TTL"); ttl != "" {
+		if confirmationTTL, err = time.ParseDuration(ttl); err != nil || confirmationTTL <= 0 {
+			configFailed("deletion-protection", "handlers.BuildDeletionProtection():Invalid value %q for DELETION_CONFIRMATION_TTL, must be a positive duration like 10m", ttl)
+			return
+		}
+	}
+	log.Infof("handlers.BuildDeletionProtection():Enabled the deletion protection of the DBClusters, BackupPlans & Backups, confirmations are valid for %s", confirmationTTL)
+
+}
+
+func registerDeletionProtection() {
+	registerValidator("/validate/delete/dbcluster", dbClusterKind, validateDeletion(dbClusterKind), "deletion-protection")
+	registerValidator("/validate/delete/backupplan", backupPlanKind, validateDeletion(backupPlanKind), "deletion-protection")
+	registerValidator("/validate/delete/backup", backupKind, validateDeletion(backupKind), "deletion-protection")
+}
+
+// validateDeletion denies the deletion of a resource labeled or annotated alloydb.cloud.google.com/protected=true
+// unless its confirmDeleteAnnotation names it & is recent, every decision goes to the audit log.
+func validateDeletion(kind schema.GroupKind) validator {
+	return func(req *validationRequest) (field.ErrorList, error) {
+
+		if req.ar.Request.Operation != v1beta1.Delete {
+			return nil, nil
+		}
+		if len(req.ar.Request.OldObject.Raw) == 0 {
+			audit(req, "deletion-protection", kind.Kind, false, "the API server did not send the resource")
+			return nil, fmt.Errorf("the API server did not send the %s being deleted, can't tell if it's protected", kind.Kind)
+		}
+		obj := &metav1.PartialObjectMetadata{}
+		if err := json.Unmarshal(req.ar.Request.OldObject.Raw, obj); err != nil {
+			return nil, err
+		}
+		if obj.Labels[protectedLabel] != "true" && obj.Annotations[protectedLabel] != "true" {
+			audit(req, "deletion-protection", kind.Kind, true, "not protected")
+			return nil, nil
+		}
+		confirmation, confirmed := obj.Annotations[confirmDeleteAnnotation]
+		if reason := checkConfirmation(kind, obj.Name, confirmation, confirmed); reason != "" {
+			audit(req, "deletion-protection", kind.Kind, false, reason)
+			return field.ErrorList{field.Forbidden(field.NewPath("metadata", "annotations").Key(confirmDeleteAnnotation), reason)}, nil
+		}
+
+		audit(req, "deletion-protection", kind.Kind, true, fmt.Sprintf("protected, deletion confirmed: %s", confirmation))
+		req.warn("deleting the protected %s %s confirmed by %s", kind.Kind, obj.Name, confirmDeleteAnnotation)
+		return nil, nil
+
+	}
+}
+
+// checkConfirmation returns why the confirmation doesn't let the resource be deleted, empty when it does.
+func checkConfirmation(kind schema.GroupKind, name, confirmation string, confirmed bool) string {
+
+	usage := fmt.Sprintf("annotate it with %s=\"%s $(date -u +%%FT%%TZ)\" to delete it within %s", confirmDeleteAnnotation, name, confirmationTTL)
+	if !confirmed {
+		return fmt.Sprintf("the %s is protected by %s=true, %s", kind.Kind, protectedLabel, usage)
+	}
+	fields := strings.Fields(confirmation)
+	if len(fields) != 2 || fields[0] != name {
+		return fmt.Sprintf("the %s is protected by %s=true & %s is %q instead of its name & the time, %s", kind.Kind, protectedLabel, confirmDeleteAnnotation, confirmation, usage)
+	}
+	at, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		return fmt.Sprintf("the %s is protected by %s=true & the time of %s isn't RFC 3339:: %v, %s", kind.Kind, protectedLabel, confirmDeleteAnnotation, err, usage)
+	}
+	switch age := now().Sub(at); {
+	case age > confirmationTTL:
+		return fmt.Sprintf("the %s is protected by %s=true & %s set at %s has expired, %s", kind.Kind, protectedLabel, confirmDeleteAnnotation, fields[1], usage)
+	case age < -confirmationSkew:
+		return fmt.Sprintf("the %s is protected by %s=true & %s is set in the future at %s, %s", kind.Kind, protectedLabel, confirmDeleteAnnotation, fields[1], usage)
+	}
+	return ""
+
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestValidateDeletion(t *testing.T) {
+	tests := []struct {
+		id         int
+		name       string
+		path       string
+		oldObject  string
+		allowed    bool
+		wantFields []string
+	}{
+		{
+			name:      "Unprotected DBCluster",
+			id:        0,
+			path:      "/validate/delete/dbcluster",
+			oldObject: `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "staging"}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Protected DBCluster",
+			id:         1,
+			path:       "/validate/delete/dbcluster",
+			oldObject:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "prod", "labels": {"alloydb.cloud.google.com/protected": "true"}}}`,
+			allowed:    false,
+			wantFields: []string{"metadata.annotations[alloydb.cloud.google.com/confirm-delete]"},
+		},
+		{
+			name:       "Protected BackupPlan Confirmed For Another One",
+			id:         2,
+			path:       "/validate/delete/backupplan",
+			oldObject:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "BackupPlan", "metadata": {"namespace": "db", "name": "prod-plan", "annotations": {"alloydb.cloud.google.com/protected": "true", "alloydb.cloud.google.com/confirm-delete": "staging-plan 2026-10-17T11:58:00Z"}}}`,
+			allowed:    false,
+			wantFields: []string{"metadata.annotations[alloydb.cloud.google.com/confirm-delete]"},
+		},
+		{
+			name:      "Confirmed Deletion Of A Protected Backup",
+			id:        3,
+			path:      "/validate/delete/backup",
+			oldObject: `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Backup", "metadata": {"namespace": "db", "name": "backup1", "labels": {"alloydb.cloud.google.com/protected": "true"}, "annotations": {"alloydb.cloud.google.com/confirm-delete": "backup1 2026-10-17T11:58:00Z"}}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Expired Confirmation Left Over From An Earlier Deletion",
+			id:         4,
+			path:       "/validate/delete/dbcluster",
+			oldObject:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "prod", "labels": {"alloydb.cloud.google.com/protected": "true"}, "annotations": {"alloydb.cloud.google.com/confirm-delete": "prod 2026-10-16T12:00:00Z"}}}`,
+			allowed:    false,
+			wantFields: []string{"metadata.annotations[alloydb.cloud.google.com/confirm-delete]"},
+		},
+		{
+			name:       "Confirmation Set In The Future",
+			id:         5,
+			path:       "/validate/delete/dbcluster",
+			oldObject:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "prod", "labels": {"alloydb.cloud.google.com/protected": "true"}, "annotations": {"alloydb.cloud.google.com/confirm-delete": "prod 2027-01-01T00:00:00Z"}}}`,
+			allowed:    false,
+			wantFields: []string{"metadata.annotations[alloydb.cloud.google.com/confirm-delete]"},
+		},
+		{
+			name:       "Confirmation Without A Time",
+			id:         6,
+			path:       "/validate/delete/dbcluster",
+			oldObject:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "prod", "labels": {"alloydb.cloud.google.com/protected": "true"}, "annotations": {"alloydb.cloud.google.com/confirm-delete": "prod"}}}`,
+			allowed:    false,
+			wantFields: []string{"metadata.annotations[alloydb.cloud.google.com/confirm-delete]"},
+		},
+	}
+
+	buf := setTestAuditLog(t) // Now is 2026-10-17T12:00:00Z
+	setTestDeletionProtection(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      "resource",
+					Namespace: "db",
+					Operation: v1beta1.Delete,
+					OldObject: runtime.RawExtension{Raw: []byte(tt.oldObject)},
+				},
+			}
+			got := validatingRoutes[tt.path](ar, nil)
+
+			if got.Allowed != tt.allowed {
+				t.Fatalf("\t%s\tTest ID=%d::Got allowed %t, want %t:: %+v", failed, tt.id, got.Allowed, tt.allowed, got.Result)
+			}
+			events := decodeTestAuditLog(t, buf)
+			if len(events) != 1 || events[0].Allowed != tt.allowed {
+				t.Errorf("\t%s\tTest ID=%d::Got the audit events %+v, want one with allowed %t", failed, tt.id, events, tt.allowed)
+			}
+			if tt.allowed {
+				return
+			}
+			fields := []string{}
+			for _, cause := range got.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %s", failed, tt.id, fields, tt.wantFields, got.Result.Message)
+			}
+		})
+	}
+}
+
+func setTestDeletionProtection(t *testing.T) {
+
+	paths := []string{"/validate/delete/dbcluster", "/validate/delete/backupplan", "/validate/delete/backup"}
+	savedRoutes := map[string]AdmitFunc{}
+	for _, path := range paths {
+		savedRoutes[path] = validatingRoutes[path]
+	}
+	registerDeletionProtection()
+	t.Cleanup(func() {
+		for path, route := range savedRoutes {
+			if route == nil {
+				delete(validatingRoutes, path)
+			} else {
+				validatingRoutes[path] = route
+			}
+		}
+	})
+
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	log "k8s.io/klog/v2"
+)
+
+// FailureMode decides what happens to the objects whose handler uses a config file that is missing or broken, the
+// webhook keeps running either way so the choice isn't left to failurePolicy of a crash looping webhook.
+type FailureMode string
+
+const (
+	// FailureModeClosed denies the pods with a Status telling the config is broken.
+	FailureModeClosed FailureMode = "fail-closed"
+	// FailureModeOpen admits the pods unmutated with a warning.
+	FailureModeOpen FailureMode = "fail-open"
+	// FailureModeNotReady answers like FailureModeClosed & fails the readiness probe at /readyz, so a rollout with a
+	// broken config stalls on the new pods while the old ones keep serving.
+	FailureModeNotReady FailureMode = "not-ready"
+)
+
+var failureMode = FailureModeClosed
+
+var configErrors []string // Written by the Build functions at start up only
+
+var failedConfigs = map[string][]string{} // The errors of configErrors keyed by the config they're about
+
+// podConfigs are the configs the pod mutators depend on, the other handlers are gated on the configs they register with.
+var podConfigs = []string{"tolerations", "selectors", "placement", "failover", "openshift", "rules", "namespace-bounds",
+	"placement-policies", "mutation-mode", "allowlist", "dry-run", "namespaces"}
+
+var (
+	configErrorsMetric = newMetric("alloydb_webhook_config_errors", "gauge",
+		"Config files or settings the webhook could not load.")
+	configFailureAdmissionsMetric = newMetric("alloydb_webhook_config_failure_admissions_total", "counter",
+		"Pods denied or admitted unmutated because the config could not be loaded, by failure mode.")
+)
+
+// BuildFailureMode reads FAILURE_MODE, it must run before the other Build functions.
+func BuildFailureMode() {
+	mode := FailureMode(os.Getenv("FAILURE_MODE"))
+	switch mode {
+	case "":
+	case FailureModeClosed, FailureModeOpen, FailureModeNotReady:
+		failureMode = mode
+	default:
+		log.Fatalf("handlers.BuildFailureMode():Invalid value %q for FAILURE_MODE, must be %s, %s or %s", mode, FailureModeClosed, FailureModeOpen, FailureModeNotReady)
+	}
+	configErrorsMetric.set("", 0)
+	log.Infof("handlers.BuildFailureMode():The webhook will %s when its config can't be loaded", failureMode)
+
+}
+
+// configFailed records the config the Build functions could not load instead of exiting, config names it like the
+// kinds of validate-config & the message has the same handlers.BuildX():... form as the log messages.
+func configFailed(config, format string, args ...interface{}) {
+
+	msg := fmt.Sprintf(format, args...)
+	log.ErrorDepth(1, msg)
+	if _, detail, found := strings.Cut(msg, "():"); found {
+		msg = detail
+	}
+	configErrors = append(configErrors, msg)
+	failedConfigs[config] = append(failedConfigs[config], msg)
+	configErrorsMetric.set("", float64(len(configErrors)))
+
+}
+
+// configFailureResponse answers for the object when one of the configs its handler uses is broken, nil when it can be
+// admitted as usual. skipped tells the client what the webhook didn't do when it fails open, like "pod was not mutated".
+func configFailureResponse(ar *v1beta1.AdmissionReview, skipped string, configs ...string) *v1beta1.AdmissionResponse {
+
+	errs := []string{}
+	for _, config := range configs {
+		errs = append(errs, failedConfigs[config]...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	configFailureAdmissionsMetric.add(fmt.Sprintf("mode=%q", failureMode), 1)
+	reason := strings.Join(errs, "; ")
+	if failureMode == FailureModeOpen {
+		log.Warningf("handlers.configFailureResponse():Admitting the %s %s/%s, the config could not be loaded:: %s", ar.Request.Kind.Kind, ar.Request.Namespace, ar.Request.Name, reason)
+		return &v1beta1.AdmissionResponse{
+			UID:      ar.Request.UID,
+			Allowed:  true,
+			Warnings: []string{fmt.Sprintf("%s, the AlloyDB webhook fails open because its config could not be loaded: %s", skipped, reason)},
+			Result: &metav1.Status{
+				Status: "Success",
+			},
+		}
+	}
+	log.Errorf("handlers.configFailureResponse():Denying the %s %s/%s, the config could not be loaded:: %s", ar.Request.Kind.Kind, ar.Request.Namespace, ar.Request.Name, reason)
+	return &v1beta1.AdmissionResponse{
+		UID:     ar.Request.UID,
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusInternalServerError,
+			Reason:  metav1.StatusReasonInternalError,
+			Message: fmt.Sprintf("the AlloyDB webhook fails closed because its config could not be loaded: %s", reason),
+		},
+	}
+
+}
+
+// serveReady is the readiness probe, it only fails in the not-ready mode while a config could not be loaded. The other
+// modes stay ready so the Service keeps sending the reviews they answer for the broken config.
+func serveReady(w http.ResponseWriter, r *http.Request) {
+
+	if failureMode == FailureModeNotReady && len(configErrors) > 0 {
+		http.Error(w, fmt.Sprintf("the config could not be loaded: %s", strings.Join(configErrors, "; ")), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+
+}
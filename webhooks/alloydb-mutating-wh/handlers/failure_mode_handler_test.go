@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestMutatePodConfigFailure(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		mode FailureMode
+		want *v1beta1.AdmissionResponse
+	}{
+		{
+			name: "Fail Closed",
+			id:   0,
+			mode: FailureModeClosed,
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: false,
+				Result: &metav1.Status{
+					Status:  metav1.StatusFailure,
+					Code:    500,
+					Reason:  metav1.StatusReasonInternalError,
+					Message: "the AlloyDB webhook fails closed because its config could not be loaded: Error opening tolerations config file /etc/tolerations/missing:: open /etc/tolerations/missing: no such file or directory",
+				},
+			},
+		},
+		{
+			name: "Fail Open",
+			id:   1,
+			mode: FailureModeOpen,
+			want: &v1beta1.AdmissionResponse{
+				UID:      types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed:  true,
+				Warnings: []string{"pod was not mutated, the AlloyDB webhook fails open because its config could not be loaded: Error opening tolerations config file /etc/tolerations/missing:: open /etc/tolerations/missing: no such file or directory"},
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+	}
+
+	ar := &v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+			Namespace: "fake-ns",
+			Object: runtime.RawExtension{
+				Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestFailureMode(t, tt.mode)
+			t.Setenv("TOLERATION_CONFIG_PATH", "/etc/tolerations")
+			t.Setenv("TOLERATION_CONFIG_FILE", "missing")
+			BuildTolerations()
+			got := mutatePod(ar, tolerations)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+			if count := configFailureAdmissionsMetric.get(`mode="` + string(tt.mode) + `"`); count != 1 {
+				t.Errorf("\t%s\tTest ID=%d::Got %v admissions counted, want 1", failed, tt.id, count)
+			}
+		})
+	}
+}
+
+func TestConfigFailureScope(t *testing.T) {
+	tests := []struct {
+		id          int
+		name        string
+		failed      []string // Configs failing to load
+		wantAllowed bool
+	}{
+		{
+			name:        "Pod Config Broken",
+			id:          0,
+			failed:      []string{"tolerations", "selectors"},
+			wantAllowed: true,
+		},
+		{
+			name:        "Validator Config Broken",
+			id:          1,
+			failed:      []string{"dbcluster-policy"},
+			wantAllowed: false,
+		},
+	}
+
+	ar := &v1beta1.AdmissionReview{
+		Request: &v1beta1.AdmissionRequest{
+			UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+			Namespace: "fake-ns",
+			Name:      "fake-cluster",
+			Object: runtime.RawExtension{
+				Raw: []byte(`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "fake-cluster"}}`),
+			},
+		},
+	}
+	admit := validating(dbClusterKind, func(*validationRequest) (field.ErrorList, error) { return nil, nil }, []string{"dbcluster-policy"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestFailureMode(t, FailureModeClosed)
+			for _, config := range tt.failed {
+				configFailed(config, "handlers.BuildX():Error loading the %s config", config)
+			}
+			got := admit(ar, nil)
+
+			if got.Allowed != tt.wantAllowed {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want allowed %v", failed, tt.id, got, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	setTestFailureMode(t, FailureModeOpen)
+	configFailed("selectors", "handlers.BuildSelectors():Error loading the node selectors data from the file:: %v", "bad")
+	configFailureResponse(&v1beta1.AdmissionReview{Request: &v1beta1.AdmissionRequest{}}, "pod was not mutated", "selectors")
+
+	rec := httptest.NewRecorder()
+	serveMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	for _, want := range []string{
+		"# TYPE alloydb_webhook_config_errors gauge\nalloydb_webhook_config_errors 1\n",
+		"alloydb_webhook_config_failure_admissions_total{mode=\"fail-open\"} 1\n",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("\t%s\tGot metrics %s, want them to contain %s", failed, rec.Body.String(), want)
+		}
+	}
+}
+
+// setTestFailureMode starts from a config without errors & fresh metrics.
+func setTestFailureMode(t *testing.T, mode FailureMode) {
+
+	savedMode, savedErrors, savedFailed, savedTolerations := failureMode, configErrors, failedConfigs, tolerations
+	failureMode, configErrors, failedConfigs = mode, nil, map[string][]string{}
+	configErrorsMetric.values = map[string]float64{}
+	configFailureAdmissionsMetric.values = map[string]float64{}
+	t.Cleanup(func() {
+		failureMode, configErrors, failedConfigs, tolerations = savedMode, savedErrors, savedFailed, savedTolerations
+		configErrorsMetric.set("", float64(len(savedErrors)))
+	})
+}
+
+func TestServeReady(t *testing.T) {
+	tests := []struct {
+		id       int
+		name     string
+		mode     FailureMode
+		broken   bool
+		wantCode int
+	}{
+		{name: "Not Ready Without Errors", id: 0, mode: FailureModeNotReady, wantCode: 200},
+		{name: "Not Ready With Errors", id: 1, mode: FailureModeNotReady, broken: true, wantCode: 503},
+		{name: "Fail Closed With Errors", id: 2, mode: FailureModeClosed, broken: true, wantCode: 200},
+		{name: "Fail Open With Errors", id: 3, mode: FailureModeOpen, broken: true, wantCode: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestFailureMode(t, tt.mode)
+			if tt.broken {
+				configFailed("selectors", "handlers.BuildSelectors():Error loading the node selectors data from the file:: %v", "bad")
+			}
+			rec := httptest.NewRecorder()
+			serveReady(rec, httptest.NewRequest("GET", "/readyz", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("\t%s\tTest ID=%d::Got status %d, want %d", failed, tt.id, rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// majorUpgradeBackupWindow is how recent the Backup a major version upgrade needs must be, 0 when not guarded.
+var majorUpgradeBackupWindow time.Duration
+
+// BuildMajorUpgradeGuard checks the major version upgrades of the DBClusters at /validate/dbcluster when
+// MAJOR_UPGRADE_BACKUP_WINDOW is set to a duration like 24h, it watches the Backups.
+func BuildMajorUpgradeGuard() {
+	value := os.Getenv("MAJOR_UPGRADE_BACKUP_WINDOW")
+	if value == "" {
+		return
+	}
+	registerDBClusterCheck("major-upgrade", validateMajorUpgrade, "major-upgrade", "alloydb")
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		configFailed("major-upgrade", "handlers.BuildMajorUpgradeGuard():Invalid value %q for MAJOR_UPGRADE_BACKUP_WINDOW, must be a positive duration like 24h:: %v", value, err)
+		return
+	}
+	majorUpgradeBackupWindow = window
+	watchAlloyDB(backupResource)
+	log.Infof("handlers.BuildMajorUpgradeGuard():Enabled the major version upgrade guard, a Backup must have succeeded within %s", window)
+
+}
+
+// validateMajorUpgrade denies raising the major version of the databaseVersion of a DBCluster, which can't be undone,
+// unless a Backup of the DBCluster succeeded within majorUpgradeBackupWindow. The latest such Backup is named in a
+// warning when the upgrade is allowed.
+func validateMajorUpgrade(req *validationRequest) (field.ErrorList, error) {
+
+	if req.ar.Request.Operation != v1beta1.Update || len(req.ar.Request.OldObject.Raw) == 0 {
+		return nil, nil
+	}
+	cluster, old := &DBCluster{}, &DBCluster{}
+	if err := json.Unmarshal(req.ar.Request.Object.Raw, cluster); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(req.ar.Request.OldObject.Raw, old); err != nil {
+		return nil, err
+	}
+	from, fromOK := majorVersion(old.Spec.DatabaseVersion)
+	to, toOK := majorVersion(cluster.Spec.DatabaseVersion)
+	if !fromOK || !toOK || to <= from {
+		return nil, nil
+	}
+
+	backups, err := alloyDB.listBackups(req.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the Backups: %v", err)
+	}
+	var latest *Backup
+	for _, b := range backups {
+		if b.Spec.DBClusterRef != cluster.Name || b.Status.Phase != backupSucceededPhase || b.Status.CompleteTime == nil {
+			continue
+		}
+		if latest == nil || b.Status.CompleteTime.After(latest.Status.CompleteTime.Time) {
+			latest = b
+		}
+	}
+	since := now().Add(-majorUpgradeBackupWindow)
+	if latest == nil || latest.Status.CompleteTime.Time.Before(since) {
+		found := "none did"
+		if latest != nil {
+			found = fmt.Sprintf("the latest, %s, completed at %s", latest.Name, latest.Status.CompleteTime.UTC().Format(time.RFC3339))
+		}
+		reason := fmt.Sprintf("upgrading from the major version %d to %d can't be undone, it needs a Backup of the DBCluster %s that succeeded within the last %s & %s",
+			from, to, cluster.Name, majorUpgradeBackupWindow, found)
+		audit(req, "major-upgrade-guard", dbClusterKind.Kind, false, reason)
+		return field.ErrorList{field.Forbidden(field.NewPath("spec", "databaseVersion"), reason)}, nil
+	}
+	reason := fmt.Sprintf("upgrading from the major version %d to %d after the Backup %s completed at %s",
+		from, to, latest.Name, latest.Status.CompleteTime.UTC().Format(time.RFC3339))
+	audit(req, "major-upgrade-guard", dbClusterKind.Kind, true, reason)
+	req.warn("%s, restore it into a new DBCluster to go back", reason)
+	return nil, nil
+
+}
+
+// majorVersion returns the major version of a databaseVersion like 16.8.0.
+func majorVersion(version string) (int, bool) {
+	major, _, _ := strings.Cut(version, ".")
+	v, err := strconv.Atoi(major)
+	return v, err == nil
+}
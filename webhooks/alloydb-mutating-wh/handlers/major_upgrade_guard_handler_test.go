@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestValidateMajorUpgrade(t *testing.T) {
+	tests := []struct {
+		id          int
+		name        string
+		operation   v1beta1.Operation
+		cluster     string
+		from        string
+		to          string
+		allowed     bool
+		wantFields  []string
+		wantMessage string
+	}{
+		{
+			name:        "Recent Backup",
+			id:          0,
+			operation:   v1beta1.Update,
+			cluster:     "orders",
+			from:        "16.8.0",
+			to:          "17.5.0",
+			allowed:     true,
+			wantMessage: "after the Backup orders-recent completed at 2026-10-17T06:00:00Z",
+		},
+		{
+			name:        "Stale Backup",
+			id:          1,
+			operation:   v1beta1.Update,
+			cluster:     "billing",
+			from:        "16.8.0",
+			to:          "17.5.0",
+			allowed:     false,
+			wantFields:  []string{"spec.databaseVersion"},
+			wantMessage: "within the last 24h0m0s & the latest, billing-old, completed at 2026-10-10T06:00:00Z",
+		},
+		{
+			name:        "No Backup",
+			id:          2,
+			operation:   v1beta1.Update,
+			cluster:     "inventory",
+			from:        "15.7.0",
+			to:          "16.8.0",
+			allowed:     false,
+			wantFields:  []string{"spec.databaseVersion"},
+			wantMessage: "upgrading from the major version 15 to 16 can't be undone",
+		},
+		{
+			name:      "Minor Upgrade",
+			id:        3,
+			operation: v1beta1.Update,
+			cluster:   "inventory",
+			from:      "16.3.0",
+			to:        "16.8.0",
+			allowed:   true,
+		},
+		{
+			name:      "Creation",
+			id:        4,
+			operation: v1beta1.Create,
+			cluster:   "inventory",
+			to:        "17.5.0",
+			allowed:   true,
+		},
+	}
+
+	setTestAuditLog(t)
+	setTestMajorUpgradeGuard(t)
+	admit := validatingRoutes["/validate/dbcluster"]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object := `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"name": "` + tt.cluster + `"}, "spec": {"databaseVersion": "%s"}}`
+			oldObject := ""
+			if tt.from != "" {
+				oldObject = strings.Replace(object, "%s", tt.from, 1)
+			}
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      tt.cluster,
+					Namespace: "db",
+					Operation: tt.operation,
+					Object:    runtime.RawExtension{Raw: []byte(strings.Replace(object, "%s", tt.to, 1))},
+					OldObject: runtime.RawExtension{Raw: []byte(oldObject)},
+				},
+			}
+			got := admit(ar, nil)
+
+			if got.Allowed != tt.allowed {
+				t.Fatalf("\t%s\tTest ID=%d::Got allowed %t, want %t:: %+v", failed, tt.id, got.Allowed, tt.allowed, got.Result)
+			}
+			message := strings.Join(got.Warnings, "\n")
+			if !tt.allowed {
+				message = got.Result.Message
+				fields := []string{}
+				for _, cause := range got.Result.Details.Causes {
+					fields = append(fields, cause.Field)
+				}
+				if !reflect.DeepEqual(fields, tt.wantFields) {
+					t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %s", failed, tt.id, fields, tt.wantFields, message)
+				}
+			}
+			if tt.wantMessage == "" && message != "" || !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("\t%s\tTest ID=%d::Got the message %q, want it to contain %q", failed, tt.id, message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+// setTestMajorUpgradeGuard asks for a Backup within 24h, orders has one, billing an older one & inventory none.
+// setTestAuditLog sets the time to 2026-10-17T12:00:00Z.
+func setTestMajorUpgradeGuard(t *testing.T) {
+
+	setTestAlloyDB(t,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Backup", "metadata": {"namespace": "db", "name": "orders-old"}, "spec": {"dbclusterRef": "orders"}, "status": {"phase": "Succeeded", "completeTime": "2026-10-15T06:00:00Z"}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Backup", "metadata": {"namespace": "db", "name": "orders-recent"}, "spec": {"dbclusterRef": "orders"}, "status": {"phase": "Succeeded", "completeTime": "2026-10-17T06:00:00Z"}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Backup", "metadata": {"namespace": "db", "name": "billing-failed"}, "spec": {"dbclusterRef": "billing"}, "status": {"phase": "Failed", "completeTime": "2026-10-17T10:00:00Z"}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Backup", "metadata": {"namespace": "db", "name": "billing-old"}, "spec": {"dbclusterRef": "billing"}, "status": {"phase": "Succeeded", "completeTime": "2026-10-10T06:00:00Z"}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Backup", "metadata": {"namespace": "other", "name": "inventory"}, "spec": {"dbclusterRef": "inventory"}, "status": {"phase": "Succeeded", "completeTime": "2026-10-17T06:00:00Z"}}`,
+	)
+	savedWindow := majorUpgradeBackupWindow
+	majorUpgradeBackupWindow = 24 * time.Hour
+	setTestDBClusterCheck(t, "major-upgrade", validateMajorUpgrade)
+	t.Cleanup(func() {
+		majorUpgradeBackupWindow = savedWindow
+	})
+
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// metric is a Prometheus gauge or counter, its values are keyed by the rendered labels like mode="fail-open".
+type metric struct {
+	name string
+	kind string
+	help string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+var registeredMetrics []*metric
+
+func newMetric(name, kind, help string) *metric {
+	m := &metric{name: name, kind: kind, help: help, values: map[string]float64{}}
+	registeredMetrics = append(registeredMetrics, m)
+	return m
+}
+
+func (m *metric) add(labels string, value float64) {
+	m.mu.Lock()
+	m.values[labels] += value
+	m.mu.Unlock()
+}
+
+func (m *metric) set(labels string, value float64) {
+	m.mu.Lock()
+	m.values[labels] = value
+	m.mu.Unlock()
+}
+
+func (m *metric) get(labels string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[labels]
+}
+
+// serveMetrics writes the metrics in the Prometheus text format.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range registeredMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		m.mu.Lock()
+		labels := make([]string, 0, len(m.values))
+		for l := range m.values {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			if l == "" {
+				fmt.Fprintf(w, "%s %g\n", m.name, m.values[l])
+			} else {
+				fmt.Fprintf(w, "%s{%s} %g\n", m.name, l, m.values[l])
+			}
+		}
+		m.mu.Unlock()
+	}
+
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	log "k8s.io/klog/v2"
+)
+
+const (
+	placementPolicyValidCondition = "Valid"
+	placementPolicyStatusInterval = 30 * time.Second
+)
+
+var placementPolicyResource = schema.GroupVersionResource{
+	Group:    "placement.alloydb.cloud.google.com",
+	Version:  "v1alpha1",
+	Resource: "placementpolicies",
+}
+
+// PlacementPolicy places the pods of its own namespace, it's matched & applied like a PodRule from RULES_CONFIG_FILE
+// after the configured rules, so the admin's rules win over the ones of the namespace owners. Its tolerations, node
+// selectors & node affinity must stay within the NamespaceBounds like the namespace annotations, or it's invalid.
+type PlacementPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PlacementPolicySpec   `json:"spec,omitempty"`
+	Status PlacementPolicyStatus `json:"status,omitempty"`
+}
+
+type PlacementPolicySpec struct {
+	PodSelector  *metav1.LabelSelector `json:"podSelector,omitempty"`
+	Roles        []string              `json:"roles,omitempty"`
+	Tolerations  []corev1.Toleration   `json:"tolerations,omitempty"`
+	NodeSelector map[string]string     `json:"nodeSelector,omitempty"`
+	Affinity     *corev1.Affinity      `json:"affinity,omitempty"`
+	Policy       MergePolicy           `json:"policy,omitempty"`
+}
+
+type PlacementPolicyStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	MatchCount         int64              `json:"matchCount,omitempty"`
+	LastMatchTime      *metav1.Time       `json:"lastMatchTime,omitempty"`
+}
+
+// placementPolicy is the compiled policy along with what's still to be written to its status.
+type placementPolicy struct {
+	namespace  string
+	name       string
+	generation int64
+	rule       *PodRule // nil when the policy is invalid
+	err        error
+
+	matches   int64 // Matches not written to the status yet, updated atomically
+	lastMatch int64 // Unix nanoseconds, updated atomically
+}
+
+// policyWatcher keeps the compiled policies in step with the informer's cache & writes their status back.
+type policyWatcher struct {
+	client dynamic.Interface
+	lister cache.GenericLister
+
+	mu       sync.RWMutex
+	policies map[string]*placementPolicy // Keyed by namespace/name
+}
+
+var placementPolicies *policyWatcher
+
+// BuildPlacementPolicies starts watching the PlacementPolicy resources when PLACEMENT_POLICIES is set to true, the
+// CRD must be installed before the webhook starts.
+func BuildPlacementPolicies() {
+	value := os.Getenv("PLACEMENT_POLICIES")
+	if value == "" {
+		return
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		configFailed("placement-policies", "handlers.BuildPlacementPolicies():Invalid value %q for PLACEMENT_POLICIES:: %v", value, err)
+		return
+	}
+	if !enabled {
+		return
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		configFailed("placement-policies", "handlers.BuildPlacementPolicies():Could not load the in-cluster config for the Kubernetes client:: %v", err)
+		return
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		configFailed("placement-policies", "handlers.BuildPlacementPolicies():Could not create the Kubernetes client:: %v", err)
+		return
+	}
+	stop := make(chan struct{}) // Runs for the lifetime of the webhook
+	if placementPolicies, err = newPolicyWatcher(client, stop); err != nil {
+		configFailed("placement-policies", "handlers.BuildPlacementPolicies():Could not watch the placement policies:: %v", err)
+		return
+	}
+	go wait.Until(placementPolicies.syncStatus, placementPolicyStatusInterval, stop)
+	log.Info("handlers.BuildPlacementPolicies():Watching the placement policies")
+
+}
+
+func newPolicyWatcher(client dynamic.Interface, stop <-chan struct{}) (*policyWatcher, error) {
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := factory.ForResource(placementPolicyResource)
+	w := &policyWatcher{
+		client:   client,
+		lister:   informer.Lister(),
+		policies: map[string]*placementPolicy{},
+	}
+	if _, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.set,
+		UpdateFunc: func(_, obj interface{}) { w.set(obj) },
+		DeleteFunc: w.delete,
+	}); err != nil {
+		return nil, err
+	}
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(stop, informer.Informer().HasSynced) {
+		return nil, fmt.Errorf("the placement policy cache did not sync")
+	}
+	return w, nil
+
+}
+
+func (w *policyWatcher) set(obj interface{}) {
+
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	p := &PlacementPolicy{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, p); err != nil {
+		log.Errorf("handlers.policyWatcher.set():Could not read the placement policy %s/%s:: %v", u.GetNamespace(), u.GetName(), err)
+		return
+	}
+	key := p.Namespace + "/" + p.Name
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if existing, ok := w.policies[key]; ok && existing.generation == p.Generation {
+		return // Only the status changed
+	}
+	compiled := &placementPolicy{namespace: p.Namespace, name: p.Name, generation: p.Generation}
+	rule := &PodRule{
+		Name:         "placementpolicy/" + key,
+		Namespaces:   []string{p.Namespace},
+		Roles:        p.Spec.Roles,
+		PodSelector:  p.Spec.PodSelector,
+		Tolerations:  p.Spec.Tolerations,
+		NodeSelector: p.Spec.NodeSelector,
+		Affinity:     p.Spec.Affinity,
+		Policy:       p.Spec.Policy,
+	}
+	errs := rule.validate(field.NewPath("spec"))
+	errs = append(errs, namespaceBounds.check(p.Spec.Tolerations, p.Spec.NodeSelector, p.Spec.Affinity, field.NewPath("spec"))...)
+	if len(errs) != 0 {
+		compiled.err = errs.ToAggregate()
+	} else {
+		compiled.err = rule.compile()
+	}
+	if compiled.err != nil {
+		log.Errorf("handlers.policyWatcher.set():Placement policy %s is invalid:: %v", key, compiled.err)
+	} else {
+		rule.onMatch = compiled.matched
+		compiled.rule = rule
+	}
+	w.policies[key] = compiled
+	log.Infof("handlers.policyWatcher.set():Loaded the generation %d of the placement policy %s", p.Generation, key)
+
+}
+
+func (w *policyWatcher) delete(obj interface{}) {
+
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	delete(w.policies, u.GetNamespace()+"/"+u.GetName())
+	w.mu.Unlock()
+
+}
+
+func (p *placementPolicy) matched() {
+	atomic.AddInt64(&p.matches, 1)
+	atomic.StoreInt64(&p.lastMatch, time.Now().UnixNano())
+}
+
+// rules returns the valid policies of the namespace ordered by name.
+func (w *policyWatcher) rules(namespace string) []*PodRule {
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	names := []string{}
+	rules := map[string]*PodRule{}
+	for _, p := range w.policies {
+		if p.namespace == namespace && p.rule != nil {
+			names = append(names, p.name)
+			rules[p.name] = p.rule
+		}
+	}
+	sort.Strings(names)
+	ordered := make([]*PodRule, 0, len(names))
+	for _, name := range names {
+		ordered = append(ordered, rules[name])
+	}
+	return ordered
+
+}
+
+// states returns every policy keyed by namespace/name with Valid or the reason it's invalid.
+func (w *policyWatcher) states() map[string]string {
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	states := make(map[string]string, len(w.policies))
+	for key, p := range w.policies {
+		states[key] = placementPolicyValidCondition
+		if p.err != nil {
+			states[key] = p.err.Error()
+		}
+	}
+	return states
+
+}
+
+// generations returns the namespace/name & generation of the valid policies, the ones applied to the pods.
+func (w *policyWatcher) generations() []string {
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	generations := make([]string, 0, len(w.policies))
+	for _, p := range w.policies {
+		if p.rule != nil {
+			generations = append(generations, fmt.Sprintf("placement-policy %s/%s %d", p.namespace, p.name, p.generation))
+		}
+	}
+	return generations
+
+}
+
+// syncStatus writes the validity & the matches since the last sync to the status of every policy needing it,
+// adding to the count already in the status so that all the replicas of the webhook add up.
+func (w *policyWatcher) syncStatus() {
+
+	w.mu.RLock()
+	pending := make([]*placementPolicy, 0, len(w.policies))
+	for _, p := range w.policies {
+		pending = append(pending, p)
+	}
+	w.mu.RUnlock()
+	for _, p := range pending {
+		if err := w.writeStatus(p); err != nil {
+			log.Errorf("handlers.policyWatcher.syncStatus():Could not update the status of the placement policy %s/%s:: %v", p.namespace, p.name, err)
+		}
+	}
+
+}
+
+func (w *policyWatcher) writeStatus(p *placementPolicy) error {
+
+	obj, err := w.lister.ByNamespace(p.namespace).Get(p.name)
+	if err != nil {
+		return err
+	}
+	u := obj.(*unstructured.Unstructured).DeepCopy()
+	policy := &PlacementPolicy{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, policy); err != nil {
+		return err
+	}
+	if policy.Generation != p.generation {
+		return nil // The informer hasn't caught up yet, the next sync writes it
+	}
+	condition := metav1.Condition{
+		Type:               placementPolicyValidCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Valid",
+		Message:            "The policy is applied to the matching pods",
+		ObservedGeneration: p.generation,
+	}
+	if p.err != nil {
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "InvalidSpec", p.err.Error()
+	}
+	matches := atomic.SwapInt64(&p.matches, 0)
+	changed := meta.SetStatusCondition(&policy.Status.Conditions, condition)
+	if !changed && matches == 0 && policy.Status.ObservedGeneration == p.generation {
+		return nil
+	}
+	policy.Status.ObservedGeneration = p.generation
+	policy.Status.MatchCount += matches
+	if matches != 0 {
+		lastMatch := metav1.NewTime(time.Unix(0, atomic.LoadInt64(&p.lastMatch)))
+		policy.Status.LastMatchTime = &lastMatch
+	}
+	status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&policy.Status)
+	if err != nil {
+		atomic.AddInt64(&p.matches, matches)
+		return err
+	}
+	u.Object["status"] = status
+	if _, err := w.client.Resource(placementPolicyResource).Namespace(p.namespace).UpdateStatus(context.TODO(), u, metav1.UpdateOptions{}); err != nil {
+		atomic.AddInt64(&p.matches, matches) // Counted again on the next sync
+		return err
+	}
+	return nil
+
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMutatePodPlacementPolicies(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		ar   *v1beta1.AdmissionReview
+		want *v1beta1.AdmissionResponse
+	}{
+		{
+			name: "Database Pod Matches The Policy",
+			id:   0,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-a",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"affinity": {"podAntiAffinity": {"requiredDuringSchedulingIgnoredDuringExecution": [{"topologyKey": "kubernetes.io/hostname"}]}}, "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"},{"key":"dedicated","operator":"Equal","value":"tenant-a","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"cloud.google.com/gke-nodepool":"tenant-a-db"}},{"op":"add","path":"/spec/affinity","value":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"topology.kubernetes.io/zone","operator":"In","values":["us-central1-a"]}]}]}},"podAntiAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":[{"topologyKey":"kubernetes.io/hostname"}]}}},{"op":"add","path":"/metadata/annotations","value":{"alloydb.cloud.google.com/config-hash":"ee332bc15c594cd7"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Policy Of Another Namespace",
+			id:   1,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-b",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/metadata/annotations","value":{"alloydb.cloud.google.com/config-hash":"ee332bc15c594cd7"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Policy Outside Of The Namespace Bounds",
+			id:   2,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-c",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/metadata/annotations","value":{"alloydb.cloud.google.com/config-hash":"ee332bc15c594cd7"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+	}
+
+	client := setTestPlacementPolicies(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mutatePod(tt.ar, tolerations)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+
+	placementPolicies.syncStatus()
+	statuses := []struct {
+		id         int
+		namespace  string
+		name       string
+		valid      metav1.ConditionStatus
+		matchCount int64
+	}{
+		{id: 0, namespace: "tenant-a", name: "databases", valid: metav1.ConditionTrue, matchCount: 1},
+		{id: 1, namespace: "tenant-b", name: "broken", valid: metav1.ConditionFalse, matchCount: 0},
+		{id: 2, namespace: "tenant-c", name: "control-plane", valid: metav1.ConditionFalse, matchCount: 0},
+	}
+	for _, s := range statuses {
+		u, err := client.Resource(placementPolicyResource).Namespace(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("\t%s\tStatus ID=%d::Could not get the placement policy:: %v", failed, s.id, err)
+		}
+		policy := &PlacementPolicy{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, policy); err != nil {
+			t.Fatalf("\t%s\tStatus ID=%d::Could not convert the placement policy:: %v", failed, s.id, err)
+		}
+		if !meta.IsStatusConditionPresentAndEqual(policy.Status.Conditions, placementPolicyValidCondition, s.valid) {
+			t.Errorf("\t%s\tStatus ID=%d::Got conditions %+v, want %s=%s", failed, s.id, policy.Status.Conditions, placementPolicyValidCondition, s.valid)
+		}
+		if policy.Status.MatchCount != s.matchCount {
+			t.Errorf("\t%s\tStatus ID=%d::Got matchCount %d, want %d", failed, s.id, policy.Status.MatchCount, s.matchCount)
+		}
+	}
+}
+
+// setTestPlacementPolicies watches a valid policy in tenant-a, an invalid one in tenant-b & one outside of the
+// namespace bounds in tenant-c served by a fake client.
+func setTestPlacementPolicies(t *testing.T) *dynamicfake.FakeDynamicClient {
+
+	policy := func(namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": placementPolicyResource.GroupVersion().String(),
+			"kind":       "PlacementPolicy",
+			"metadata":   map[string]interface{}{"namespace": namespace, "name": name, "generation": int64(1)},
+			"spec":       spec,
+		}}
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{placementPolicyResource: "PlacementPolicyList"},
+		policy("tenant-a", "databases", map[string]interface{}{
+			"roles":        []interface{}{RoleDatabase},
+			"tolerations":  []interface{}{map[string]interface{}{"key": "dedicated", "operator": "Equal", "value": "tenant-a", "effect": "NoSchedule"}},
+			"nodeSelector": map[string]interface{}{"cloud.google.com/gke-nodepool": "tenant-a-db"},
+			"affinity": map[string]interface{}{
+				"nodeAffinity": map[string]interface{}{
+					"requiredDuringSchedulingIgnoredDuringExecution": map[string]interface{}{
+						"nodeSelectorTerms": []interface{}{map[string]interface{}{
+							"matchExpressions": []interface{}{map[string]interface{}{"key": "topology.kubernetes.io/zone", "operator": "In", "values": []interface{}{"us-central1-a"}}},
+						}},
+					},
+				},
+				"podAntiAffinity": map[string]interface{}{
+					"requiredDuringSchedulingIgnoredDuringExecution": []interface{}{map[string]interface{}{"topologyKey": "topology.kubernetes.io/zone"}},
+				},
+			},
+		}),
+		policy("tenant-b", "broken", map[string]interface{}{
+			"nodeSelector": map[string]interface{}{"cloud.google.com/gke-nodepool": "tenant-b-db"},
+			"policy":       "override",
+		}),
+		policy("tenant-c", "control-plane", map[string]interface{}{
+			"tolerations":  []interface{}{map[string]interface{}{"key": "node-role.kubernetes.io/control-plane", "operator": "Exists"}},
+			"nodeSelector": map[string]interface{}{"cloud.google.com/gke-nodepool": "default-pool"},
+			"policy":       "enforce",
+		}),
+	)
+	savedBounds, savedNamespaces := namespaceBounds, namespaces
+	namespaces = startTestNamespaceInformer(t, fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-a"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-b"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-c"}},
+	))
+	namespaceBounds = &NamespaceBounds{
+		TolerationKeys: []string{"dedicated"},
+		NodeSelectors: map[string][]string{
+			"cloud.google.com/gke-nodepool": {"tenant-a-db", "tenant-b-db"},
+			"topology.kubernetes.io/zone":   {},
+		},
+	}
+	t.Cleanup(func() {
+		namespaceBounds, namespaces = savedBounds, savedNamespaces
+	})
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	watcher, err := newPolicyWatcher(client, stop)
+	if err != nil {
+		t.Fatalf("\t%s\tCould not watch the placement policies:: %v", failed, err)
+	}
+	// The event handlers run after the cache has synced, wait for the policies to be compiled
+	if err := wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		watcher.mu.RLock()
+		defer watcher.mu.RUnlock()
+		return len(watcher.policies) == 3, nil
+	}); err != nil {
+		t.Fatalf("\t%s\tThe placement policies were not loaded:: %v", failed, err)
+	}
+	saved := placementPolicies
+	placementPolicies = watcher
+	t.Cleanup(func() {
+		placementPolicies = saved
+	})
+	return client
+}
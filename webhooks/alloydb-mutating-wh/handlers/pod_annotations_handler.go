@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// Annotations a pod can carry to steer its own mutation.
+const (
+	skipAnnotation             = "alloydb.cloud.google.com/skip-mutation"        // "true" leaves the pod alone
+	optInAnnotation            = "alloydb.cloud.google.com/mutate"               // "true" opts the pod in under MutationModeOptIn
+	extraTolerationsAnnotation = "alloydb.cloud.google.com/extra-tolerations"    // Comma separated names from the allowlist
+	extraSelectorsAnnotation   = "alloydb.cloud.google.com/extra-node-selectors" // Comma separated names from the allowlist
+)
+
+// MutationMode decides which of the pods sent to the webhook are mutated.
+type MutationMode string
+
+const (
+	// MutationModeAll mutates every pod unless it's annotated with skipAnnotation.
+	MutationModeAll MutationMode = "all"
+	// MutationModeOptIn only mutates the pods annotated with optInAnnotation.
+	MutationModeOptIn MutationMode = "opt-in"
+)
+
+// Allowlist holds the named tolerations & node selectors pods may ask for with the extra annotations.
+type Allowlist struct {
+	Tolerations   map[string]corev1.Toleration `json:"tolerations,omitempty"`
+	NodeSelectors map[string]map[string]string `json:"nodeSelectors,omitempty"`
+}
+
+var mutationMode = MutationModeAll
+
+var allowlist Allowlist
+
+// BuildAnnotations reads the MUTATION_MODE & loads the allowlist for the extra annotations when ALLOWLIST_CONFIG_FILE is set,
+// without an allowlist every extra toleration or node selector a pod asks for is refused.
+func BuildAnnotations() {
+	switch mode := MutationMode(os.Getenv("MUTATION_MODE")); mode {
+	case "":
+	case MutationModeAll, MutationModeOptIn:
+		mutationMode = mode
+	default:
+		configFailed("mutation-mode", "handlers.BuildAnnotations():Invalid value %q for MUTATION_MODE, must be %s or %s", mode, MutationModeAll, MutationModeOptIn)
+		return
+	}
+	log.Infof("handlers.BuildAnnotations():Mutating the pods in %s mode", mutationMode)
+	fileName := os.Getenv("ALLOWLIST_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("ALLOWLIST_CONFIG_PATH"), fileName)
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("allowlist", "handlers.BuildAnnotations():Error opening allowlist config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("allowlist", "handlers.BuildAnnotations():Error reading the allowlist from the file:: %v", err)
+		return
+	}
+	if allowlist, err = loadAllowlist(data); err != nil {
+		configFailed("allowlist", "handlers.BuildAnnotations():Error loading the allowlist from the file %s:: %v", filePath, err)
+		return
+	}
+	configLoaded("allowlist", filePath, data)
+	log.Infof("handlers.BuildAnnotations():Initialized the allowlist with %d tolerations & %d node selectors", len(allowlist.Tolerations), len(allowlist.NodeSelectors))
+
+}
+
+func loadAllowlist(data []byte) (Allowlist, error) {
+
+	config := Allowlist{}
+	validate := func() field.ErrorList {
+		errs := field.ErrorList{}
+		for name, t := range config.Tolerations {
+			errs = append(errs, validateTolerations([]corev1.Toleration{t}, field.NewPath("tolerations").Key(name))...)
+		}
+		for name, s := range config.NodeSelectors {
+			errs = append(errs, validateNodeSelector(s, field.NewPath("nodeSelectors").Key(name))...)
+		}
+		return errs
+	}
+	if err := loadConfig(data, &config, validate); err != nil {
+		return Allowlist{}, err
+	}
+	return config, nil
+
+}
+
+// skipMutation tells whether the pod opted out, or didn't opt in under MutationModeOptIn, along with the reason if there's one.
+func skipMutation(pod *corev1.Pod) (bool, string) {
+
+	if skip, _ := strconv.ParseBool(pod.Annotations[skipAnnotation]); skip {
+		return true, fmt.Sprintf("pod was not mutated, it's annotated with %s=true", skipAnnotation)
+	}
+	if mutationMode == MutationModeOptIn {
+		if optIn, _ := strconv.ParseBool(pod.Annotations[optInAnnotation]); !optIn {
+			return true, fmt.Sprintf("pod was not mutated, the webhook runs in %s mode & the pod isn't annotated with %s=true", MutationModeOptIn, optInAnnotation)
+		}
+		return false, fmt.Sprintf("pod was mutated, it opted in with %s=true", optInAnnotation)
+	}
+	return false, ""
+
+}
+
+// extraPlacement resolves the tolerations & node selectors the pod asked for against the allowlist, every name is
+// either added or refused with a warning, a refused name never fails the admission.
+func extraPlacement(req *mutationRequest) {
+
+	for _, name := range annotationNames(req.pod, extraTolerationsAnnotation) {
+		t, ok := allowlist.Tolerations[name]
+		if !ok {
+			req.warn("extra toleration %q from %s was ignored, it's not in the allowlist", name, extraTolerationsAnnotation)
+			continue
+		}
+		req.extraTolerations = append(req.extraTolerations, t)
+		req.warn("added the extra toleration %q requested by %s", name, extraTolerationsAnnotation)
+	}
+	for _, name := range annotationNames(req.pod, extraSelectorsAnnotation) {
+		s, ok := allowlist.NodeSelectors[name]
+		if !ok {
+			req.warn("extra node selector %q from %s was ignored, it's not in the allowlist", name, extraSelectorsAnnotation)
+			continue
+		}
+		req.extraSelectors = mergeMaps(req.extraSelectors, s, MergePolicyKeepExisting)
+		req.warn("added the extra node selector %q requested by %s", name, extraSelectorsAnnotation)
+	}
+
+}
+
+func annotationNames(pod *corev1.Pod, annotation string) []string {
+
+	names := []string{}
+	for _, name := range strings.Split(pod.Annotations[annotation], ",") {
+		if name = strings.TrimSpace(name); name != "" && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+
+}
+
+func (req *mutationRequest) warn(format string, args ...interface{}) {
+	req.warnings = append(req.warnings, fmt.Sprintf(format, args...))
+}
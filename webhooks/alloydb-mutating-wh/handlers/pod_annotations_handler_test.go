@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMutatePodAnnotations(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		mode MutationMode
+		ar   *v1beta1.AdmissionReview
+		want *v1beta1.AdmissionResponse
+	}{
+		{
+			name: "Skip Annotation",
+			id:   0,
+			mode: MutationModeAll,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "debug-pod", "annotations": {"alloydb.cloud.google.com/skip-mutation": "true"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:      types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed:  true,
+				Warnings: []string{"pod was not mutated, it's annotated with alloydb.cloud.google.com/skip-mutation=true"},
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+		{
+			name: "Opt In Mode Without Annotation",
+			id:   1,
+			mode: MutationModeOptIn,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:      types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed:  true,
+				Warnings: []string{"pod was not mutated, the webhook runs in opt-in mode & the pod isn't annotated with alloydb.cloud.google.com/mutate=true"},
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+		{
+			name: "Opt In Mode With Annotation",
+			id:   2,
+			mode: MutationModeOptIn,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "annotations": {"alloydb.cloud.google.com/mutate": "true"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:      types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed:  true,
+				Warnings: []string{"pod was mutated, it opted in with alloydb.cloud.google.com/mutate=true"},
+				Patch:    []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Extra Tolerations And Node Selectors",
+			id:   3,
+			mode: MutationModeAll,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "migration-job", "annotations": {"alloydb.cloud.google.com/extra-tolerations": "spot, gpu", "alloydb.cloud.google.com/extra-node-selectors": "spot"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Warnings: []string{
+					`added the extra toleration "spot" requested by alloydb.cloud.google.com/extra-tolerations`,
+					`extra toleration "gpu" from alloydb.cloud.google.com/extra-tolerations was ignored, it's not in the allowlist`,
+					`added the extra node selector "spot" requested by alloydb.cloud.google.com/extra-node-selectors`,
+				},
+				Patch: []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/gke-spot","operator":"Exists","effect":"NoSchedule"},{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"cloud.google.com/gke-spot":"true"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestAnnotations(t, tt.mode)
+			got := mutatePod(tt.ar, tolerations)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func setTestAnnotations(t *testing.T, mode MutationMode) {
+
+	savedMode, savedAllowlist := mutationMode, allowlist
+	mutationMode = mode
+	allowlist = Allowlist{
+		Tolerations: map[string]corev1.Toleration{
+			"spot": {Key: "cloud.google.com/gke-spot", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+		},
+		NodeSelectors: map[string]map[string]string{
+			"spot": {"cloud.google.com/gke-spot": "true"},
+		},
+	}
+	t.Cleanup(func() {
+		mutationMode, allowlist = savedMode, savedAllowlist
+	})
+}
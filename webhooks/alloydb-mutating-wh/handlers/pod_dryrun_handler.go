@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	log "k8s.io/klog/v2"
+)
+
+// Names of the pod mutators DRY_RUN_MUTATORS takes.
+const (
+	tolerationsMutator     = "tolerations"
+	nodeSelectorMutator    = "node-selector"
+	affinityMutator        = "affinity"
+	securityContextMutator = "security-context"
+	runtimeMutator         = "runtime-scheduler"
+)
+
+var mutatorNames = []string{tolerationsMutator, nodeSelectorMutator, affinityMutator, securityContextMutator, runtimeMutator}
+
+// podMutation is the patch one of the mutators computed for the pod.
+type podMutation struct {
+	mutator string
+	ops     []patchOperation
+}
+
+var dryRunMutators []string // Their patches are reported rather than applied
+
+// BuildDryRun reads the comma separated mutators of DRY_RUN_MUTATORS, or all of them, whose patches are only reported
+// in the warnings, the audit annotations & the audit log so that a new config can be tried out on the pods.
+func BuildDryRun() {
+	value := os.Getenv("DRY_RUN_MUTATORS")
+	if value == "" {
+		return
+	}
+	mutators := []string{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "all":
+			mutators = append(mutators, mutatorNames...)
+		case containsString(mutatorNames, name):
+			mutators = append(mutators, name)
+		default:
+			configFailed("dry-run", "handlers.BuildDryRun():Invalid mutator %q in DRY_RUN_MUTATORS, must be all or among %s", name, strings.Join(mutatorNames, ", "))
+			return
+		}
+	}
+	dryRunMutators = mutators
+	log.Infof("handlers.BuildDryRun():The %s mutators only report their patches", strings.Join(dryRunMutators, ", "))
+
+}
+
+// dryRun returns the patch operations of the mutators to apply, the ones of the dry-run mutators are turned into
+// warnings, audit annotations keyed dry-run-<mutator> & audit events instead.
+func dryRun(req *mutationRequest, mutations []podMutation) ([]patchOperation, map[string]string) {
+
+	ops := []patchOperation{}
+	var annotations map[string]string
+	for _, m := range mutations {
+		if len(m.ops) == 0 {
+			continue
+		}
+		if !containsString(dryRunMutators, m.mutator) {
+			ops = append(ops, m.ops...)
+			continue
+		}
+		patch, err := json.Marshal(m.ops)
+		if err != nil {
+			patch = []byte(fmt.Sprintf("%+v", m.ops))
+		}
+		for _, op := range m.ops {
+			req.warnings = append(req.warnings, fmt.Sprintf("dry run: the %s mutator would %s %s", m.mutator, op.Op, op.Path))
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations["dry-run-"+m.mutator] = string(patch)
+		name := req.pod.Name
+		if name == "" {
+			name = req.pod.GenerateName
+		}
+		writeAuditEvent(AuditEvent{
+			Time:      now().UTC(),
+			Guard:     "dry-run",
+			Operation: req.ar.Request.Operation,
+			Kind:      "Pod",
+			Namespace: req.namespace,
+			Name:      name,
+			User:      req.ar.Request.UserInfo.Username,
+			Allowed:   true,
+			Reason:    fmt.Sprintf("the %s mutator would apply %s", m.mutator, patch),
+		})
+		log.Infof("handlers.dryRun():The %s mutator would patch the pod %s/%s with %s", m.mutator, req.namespace, name, patch)
+	}
+	return ops, annotations
+
+}
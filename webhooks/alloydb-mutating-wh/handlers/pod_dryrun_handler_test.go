@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMutatePodDryRun(t *testing.T) {
+	tests := []struct {
+		id         int
+		name       string
+		mutators   []string
+		want       *v1beta1.AdmissionResponse
+		wantEvents []string // Reasons of the audit events
+	}{
+		{
+			name:     "Dry Run Of The Security Context",
+			id:       0,
+			mutators: []string{securityContextMutator},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Warnings: []string{
+					"dry run: the security-context mutator would add /spec/securityContext",
+					"dry run: the security-context mutator would add /spec/containers/0/securityContext",
+				},
+				AuditAnnotations: map[string]string{
+					"dry-run-security-context": `[{"op":"add","path":"/spec/securityContext","value":{"runAsUser":1000650010,"runAsGroup":1000660010,"fsGroup":1000660000}},{"op":"add","path":"/spec/containers/0/securityContext","value":{"runAsUser":1000650000,"runAsNonRoot":true}}]`,
+				},
+				Patch: []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+			wantEvents: []string{
+				`the security-context mutator would apply [{"op":"add","path":"/spec/securityContext","value":{"runAsUser":1000650010,"runAsGroup":1000660010,"fsGroup":1000660000}},{"op":"add","path":"/spec/containers/0/securityContext","value":{"runAsUser":1000650000,"runAsNonRoot":true}}]`,
+			},
+		},
+		{
+			name:     "Dry Run Of All The Mutators",
+			id:       1,
+			mutators: mutatorNames,
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Warnings: []string{
+					"dry run: the tolerations mutator would replace /spec/tolerations",
+					"dry run: the security-context mutator would add /spec/securityContext",
+					"dry run: the security-context mutator would add /spec/containers/0/securityContext",
+				},
+				AuditAnnotations: map[string]string{
+					"dry-run-tolerations":      `[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]}]`,
+					"dry-run-security-context": `[{"op":"add","path":"/spec/securityContext","value":{"runAsUser":1000650010,"runAsGroup":1000660010,"fsGroup":1000660000}},{"op":"add","path":"/spec/containers/0/securityContext","value":{"runAsUser":1000650000,"runAsNonRoot":true}}]`,
+				},
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+			wantEvents: []string{
+				`the tolerations mutator would apply [{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]}]`,
+				`the security-context mutator would apply [{"op":"add","path":"/spec/securityContext","value":{"runAsUser":1000650010,"runAsGroup":1000660010,"fsGroup":1000660000}},{"op":"add","path":"/spec/containers/0/securityContext","value":{"runAsUser":1000650000,"runAsNonRoot":true}}]`,
+			},
+		},
+		{
+			name:     "Dry Run Of A Mutator Without Changes",
+			id:       2,
+			mutators: []string{affinityMutator},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/securityContext","value":{"runAsUser":1000650010,"runAsGroup":1000660010,"fsGroup":1000660000}},{"op":"add","path":"/spec/containers/0/securityContext","value":{"runAsUser":1000650000,"runAsNonRoot":true}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+			wantEvents: []string{},
+		},
+	}
+
+	setTestOpenShiftMode(t)
+	savedMutators := dryRunMutators
+	t.Cleanup(func() {
+		dryRunMutators = savedMutators
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := setTestAuditLog(t)
+			dryRunMutators = tt.mutators
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "openshift-ns",
+					Operation: v1beta1.Create,
+					UserInfo:  authenticationv1.UserInfo{Username: "fake-user"},
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"securityContext": {"runAsUser": 1000650010, "runAsGroup": 1000660010, "fsGroup": 2000}, "containers": [{"name": "fake-container", "securityContext": {"runAsUser": 1001, "runAsNonRoot": true}}]}}`),
+					},
+				},
+			}
+			got := mutatePod(ar, tolerations)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+			reasons := []string{}
+			for _, event := range decodeTestAuditLog(t, buf) {
+				if event.Guard != "dry-run" || event.Kind != "Pod" || event.Namespace != "openshift-ns" || event.Name != "fake-pod" ||
+					event.User != "fake-user" || !event.Allowed {
+					t.Errorf("\t%s\tTest ID=%d::Got the audit event %+v", failed, tt.id, event)
+				}
+				reasons = append(reasons, event.Reason)
+			}
+			if !reflect.DeepEqual(reasons, tt.wantEvents) {
+				t.Errorf("\t%s\tTest ID=%d::Got the audit events %q, want %q", failed, tt.id, reasons, tt.wantEvents)
+			}
+		})
+	}
+}
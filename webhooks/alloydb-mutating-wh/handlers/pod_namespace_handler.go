@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	log "k8s.io/klog/v2"
+)
+
+// Annotations a namespace owner sets to place the pods of the namespace, as JSON like the config files.
+const (
+	namespaceTolerationsAnnotation = "alloydb.cloud.google.com/tolerations"
+	namespaceSelectorsAnnotation   = "alloydb.cloud.google.com/node-selector"
+)
+
+// namespaceGetter looks up the namespace a pod is admitted into, the unit tests swap it for one backed by a fake client.
+type namespaceGetter interface {
+	Get(name string) (*corev1.Namespace, error)
+}
+
+// NamespaceBounds limits what the namespace annotations may ask for, anything outside of it is ignored with a warning.
+type NamespaceBounds struct {
+	TolerationKeys []string            `json:"tolerationKeys,omitempty"` // Taint keys the namespaces may tolerate
+	NodeSelectors  map[string][]string `json:"nodeSelectors,omitempty"`  // Label keys the namespaces may select on & their allowed values, any value when empty
+}
+
+var namespaces namespaceGetter
+
+var namespaceBounds *NamespaceBounds // Namespace annotations are ignored unless set
+
+// BuildNamespaceOverrides loads the bounds for the namespace annotations when NAMESPACE_BOUNDS_CONFIG_FILE is set.
+func BuildNamespaceOverrides() {
+	fileName := os.Getenv("NAMESPACE_BOUNDS_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("NAMESPACE_BOUNDS_CONFIG_PATH"), fileName)
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("namespace-bounds", "handlers.BuildNamespaceOverrides():Error opening namespace bounds config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("namespace-bounds", "handlers.BuildNamespaceOverrides():Error reading the namespace bounds from the file:: %v", err)
+		return
+	}
+	if namespaceBounds, err = loadNamespaceBounds(data); err != nil {
+		configFailed("namespace-bounds", "handlers.BuildNamespaceOverrides():Error loading the namespace bounds from the file %s:: %v", filePath, err)
+		return
+	}
+	configLoaded("namespace-bounds", filePath, data)
+	if namespaces == nil {
+		namespaces = newNamespaceGetter()
+	}
+	log.Info("handlers.BuildNamespaceOverrides():Enabled the namespace level tolerations & node selectors")
+
+}
+
+func loadNamespaceBounds(data []byte) (*NamespaceBounds, error) {
+
+	bounds := &NamespaceBounds{}
+	validate := func() field.ErrorList {
+		errs := field.ErrorList{}
+		for i, key := range bounds.TolerationKeys {
+			for _, msg := range validation.IsQualifiedName(key) {
+				errs = append(errs, field.Invalid(field.NewPath("tolerationKeys").Index(i), key, msg))
+			}
+		}
+		for key, values := range bounds.NodeSelectors {
+			errs = append(errs, metav1validation.ValidateLabelName(key, field.NewPath("nodeSelectors").Key(key))...)
+			for i, value := range values {
+				for _, msg := range validation.IsValidLabelValue(value) {
+					errs = append(errs, field.Invalid(field.NewPath("nodeSelectors").Key(key).Index(i), value, msg))
+				}
+			}
+		}
+		return errs
+	}
+	if err := loadConfig(data, bounds, validate); err != nil {
+		return nil, err
+	}
+	return bounds, nil
+
+}
+
+// newNamespaceGetter serves the namespaces from an informer's cache, so the API server isn't called for every pod.
+// It's nil when the informer can't be started, the handlers reading the namespaces are gated on the namespaces config.
+func newNamespaceGetter() namespaceGetter {
+	if failedConfigs["namespaces"] != nil {
+		return nil // Already reported
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		configFailed("namespaces", "handlers.newNamespaceGetter():Could not load the in-cluster config for the Kubernetes client:: %v", err)
+		return nil
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		configFailed("namespaces", "handlers.newNamespaceGetter():Could not create the Kubernetes client:: %v", err)
+		return nil
+	}
+	getter, err := newNamespaceLister(client, make(chan struct{})) // Runs for the lifetime of the webhook
+	if err != nil {
+		configFailed("namespaces", "handlers.newNamespaceGetter():Could not start the namespace informer:: %v", err)
+		return nil
+	}
+	return getter
+}
+
+// newNamespaceLister starts a namespace informer on the client & waits for its cache to fill, the informer
+// stops when stop is closed.
+func newNamespaceLister(client kubernetes.Interface, stop <-chan struct{}) (namespaceGetter, error) {
+
+	factory := informers.NewSharedInformerFactory(client, 0)
+	informer := factory.Core().V1().Namespaces()
+	lister := informer.Lister()
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(stop, informer.Informer().HasSynced) {
+		return nil, fmt.Errorf("the namespace cache did not sync")
+	}
+	return lister, nil
+
+}
+
+// getNamespace looks the request's namespace up once for all the mutators needing it.
+func (req *mutationRequest) getNamespace() (*corev1.Namespace, error) {
+
+	if req.ns != nil {
+		return req.ns, nil
+	}
+	ns, err := namespaces.Get(req.namespace)
+	if err != nil {
+		return nil, err
+	}
+	req.ns = ns
+	return ns, nil
+
+}
+
+// namespacePlacement reads the tolerations & node selectors the namespace annotations ask for, keeping only what
+// namespaceBounds allows. A namespace that can't be read fails the admission, a bad annotation only warns.
+func namespacePlacement(req *mutationRequest) error {
+
+	if namespaceBounds == nil {
+		return nil
+	}
+	ns, err := req.getNamespace()
+	if err != nil {
+		return fmt.Errorf("could not look up the namespace %s for the namespace overrides: %v", req.namespace, err)
+	}
+	if value, ok := ns.Annotations[namespaceTolerationsAnnotation]; ok {
+		tols := []corev1.Toleration{}
+		if err := json.Unmarshal([]byte(value), &tols); err != nil {
+			req.warn("the %s annotation of the namespace %s was ignored, it's not a list of tolerations: %v", namespaceTolerationsAnnotation, req.namespace, err)
+		}
+		for _, t := range tols {
+			if !namespaceBounds.allowsToleration(t.Key) {
+				req.warn("namespace toleration %q was ignored, the key isn't allowed for namespaces", t.Key)
+				continue
+			}
+			if errs := validateTolerations([]corev1.Toleration{t}, nil); len(errs) != 0 {
+				req.warn("namespace toleration %q was ignored, %v", t.Key, errs.ToAggregate())
+				continue
+			}
+			req.namespaceTolerations = append(req.namespaceTolerations, t)
+		}
+	}
+	if value, ok := ns.Annotations[namespaceSelectorsAnnotation]; ok {
+		selectors := map[string]string{}
+		if err := json.Unmarshal([]byte(value), &selectors); err != nil {
+			req.warn("the %s annotation of the namespace %s was ignored, it's not a map of node labels: %v", namespaceSelectorsAnnotation, req.namespace, err)
+		}
+		keys := make([]string, 0, len(selectors))
+		for k := range selectors {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys) // Keeps the warnings in a stable order
+		for _, k := range keys {
+			val := selectors[k]
+			if !namespaceBounds.allowsNodeSelector(k, val) {
+				req.warn("namespace node selector %s=%s was ignored, it isn't allowed for namespaces", k, val)
+				continue
+			}
+			if req.namespaceSelectors == nil {
+				req.namespaceSelectors = map[string]string{}
+			}
+			req.namespaceSelectors[k] = val
+		}
+	}
+	return nil
+
+}
+
+func (b *NamespaceBounds) allowsToleration(key string) bool {
+	return b != nil && containsString(b.TolerationKeys, key)
+}
+
+func (b *NamespaceBounds) allowsNodeSelector(key, value string) bool {
+	if b == nil {
+		return false
+	}
+	allowed, ok := b.NodeSelectors[key]
+	return ok && (len(allowed) == 0 || containsString(allowed, value))
+}
+
+// check returns the tolerations, node selectors & node affinity terms of a namespace owner's placement that the bounds
+// don't allow, nothing is allowed without bounds. A node affinity term may only use the In operator on a bounded key.
+func (b *NamespaceBounds) check(tols []corev1.Toleration, selectors map[string]string, affinity *corev1.Affinity, fldPath *field.Path) field.ErrorList {
+
+	errs := field.ErrorList{}
+	for i, t := range tols {
+		if !b.allowsToleration(t.Key) {
+			errs = append(errs, field.Forbidden(fldPath.Child("tolerations").Index(i).Child("key"), fmt.Sprintf("the key %s isn't allowed for namespaces", t.Key)))
+		}
+	}
+	keys := make([]string, 0, len(selectors))
+	for k := range selectors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // Keeps the errors in a stable order
+	for _, k := range keys {
+		if !b.allowsNodeSelector(k, selectors[k]) {
+			errs = append(errs, field.Forbidden(fldPath.Child("nodeSelector").Key(k), fmt.Sprintf("%s=%s isn't allowed for namespaces", k, selectors[k])))
+		}
+	}
+	if affinity == nil || affinity.NodeAffinity == nil {
+		return errs
+	}
+	nodeAffinityPath := fldPath.Child("affinity", "nodeAffinity")
+	terms := []corev1.NodeSelectorTerm{}
+	termPaths := []*field.Path{}
+	if required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution; required != nil {
+		for i, term := range required.NodeSelectorTerms {
+			terms = append(terms, term)
+			termPaths = append(termPaths, nodeAffinityPath.Child("requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms").Index(i))
+		}
+	}
+	for i, preferred := range affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		terms = append(terms, preferred.Preference)
+		termPaths = append(termPaths, nodeAffinityPath.Child("preferredDuringSchedulingIgnoredDuringExecution").Index(i).Child("preference"))
+	}
+	for i, term := range terms {
+		if len(term.MatchFields) != 0 {
+			errs = append(errs, field.Forbidden(termPaths[i].Child("matchFields"), "isn't allowed for namespaces"))
+		}
+		for j, r := range term.MatchExpressions {
+			allowed := r.Operator == corev1.NodeSelectorOpIn && len(r.Values) != 0
+			for _, value := range r.Values {
+				allowed = allowed && b.allowsNodeSelector(r.Key, value)
+			}
+			if !allowed {
+				errs = append(errs, field.Forbidden(termPaths[i].Child("matchExpressions").Index(j),
+					fmt.Sprintf("%s %s %v isn't allowed for namespaces", r.Key, r.Operator, r.Values)))
+			}
+		}
+	}
+	return errs
+
+}
+
+// overrideTolerations puts the overriding tolerations in place of the base ones with the same key.
+func overrideTolerations(base, override []corev1.Toleration) []corev1.Toleration {
+
+	combined := append([]corev1.Toleration{}, override...)
+	for _, t := range base {
+		if !exists(t, override) {
+			combined = append(combined, t)
+		}
+	}
+	return combined
+
+}
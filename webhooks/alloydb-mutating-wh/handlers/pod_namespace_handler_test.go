@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMutatePodNamespaceOverrides(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		ar   *v1beta1.AdmissionReview
+		want *v1beta1.AdmissionResponse
+	}{
+		{
+			name: "Namespace Overrides The Configured Placement",
+			id:   0,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-a",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Warnings: []string{
+					`namespace toleration "node-role.kubernetes.io/control-plane" was ignored, the key isn't allowed for namespaces`,
+					`namespace node selector node-type=gpu was ignored, it isn't allowed for namespaces`,
+					`namespace node selector topology.kubernetes.io/zone=us-central1-a was ignored, it isn't allowed for namespaces`,
+				},
+				Patch: []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"dedicated","operator":"Equal","value":"tenant-a","effect":"NoSchedule"},{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"cloud.google.com/gke-nodepool":"tenant-a-db","disk":"ssd","node-type":"database"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Pod Overrides The Namespace",
+			id:   1,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-b",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"nodeSelector": {"node-type": "database"}, "tolerations": [{"key": "cloud.google.com/alloydb-host", "operator": "Equal", "value": "tenant-b", "effect": "NoSchedule"}], "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Equal","value":"tenant-b","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"disk":"ssd","node-type":"database"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Broken Namespace Annotation",
+			id:   2,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-c",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:      types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed:  true,
+				Warnings: []string{`the alloydb.cloud.google.com/tolerations annotation of the namespace tenant-c was ignored, it's not a list of tolerations: invalid character 'd' looking for beginning of value`},
+				Patch:    []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"disk":"ssd","node-type":"database"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Unknown Namespace",
+			id:   3,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "missing-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: false,
+				Result: &metav1.Status{
+					Message: `could not look up the namespace missing-ns for the namespace overrides: namespace "missing-ns" not found`,
+				},
+			},
+		},
+	}
+
+	setTestNodeSelectors(t)
+	setTestNamespaceOverrides(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mutatePod(tt.ar, tolerations)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+// startTestNamespaceInformer serves the namespaces of the fake client from an informer stopped at the end of the test.
+func startTestNamespaceInformer(t *testing.T, client kubernetes.Interface) namespaceGetter {
+
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	getter, err := newNamespaceLister(client, stop)
+	if err != nil {
+		t.Fatalf("\t%s\tCould not start the namespace informer:: %v", failed, err)
+	}
+	return getter
+}
+
+func TestNamespaceBoundsCheck(t *testing.T) {
+	bounds := &NamespaceBounds{
+		TolerationKeys: []string{"dedicated"},
+		NodeSelectors: map[string][]string{
+			"cloud.google.com/gke-nodepool": {"tenant-a-db"},
+			"topology.kubernetes.io/zone":   {},
+		},
+	}
+	zoneAffinity := func(op corev1.NodeSelectorOperator, values ...string) *corev1.Affinity {
+		return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "topology.kubernetes.io/zone", Operator: op, Values: values}},
+			}}},
+		}}
+	}
+	tests := []struct {
+		id        int
+		name      string
+		bounds    *NamespaceBounds
+		tols      []corev1.Toleration
+		selectors map[string]string
+		affinity  *corev1.Affinity
+		want      []string // Paths of the errors
+	}{
+		{
+			name:      "Within The Bounds",
+			id:        0,
+			bounds:    bounds,
+			tols:      []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+			selectors: map[string]string{"cloud.google.com/gke-nodepool": "tenant-a-db"},
+			affinity:  zoneAffinity(corev1.NodeSelectorOpIn, "us-central1-a"),
+			want:      []string{},
+		},
+		{
+			name:      "Toleration & Node Selector Beyond The Bounds",
+			id:        1,
+			bounds:    bounds,
+			tols:      []corev1.Toleration{{Key: "node-role.kubernetes.io/control-plane", Operator: corev1.TolerationOpExists}},
+			selectors: map[string]string{"cloud.google.com/gke-nodepool": "default-pool", "node-type": "gpu"},
+			want:      []string{"spec.tolerations[0].key", "spec.nodeSelector[cloud.google.com/gke-nodepool]", "spec.nodeSelector[node-type]"},
+		},
+		{
+			name:     "Node Affinity Without In",
+			id:       2,
+			bounds:   bounds,
+			affinity: zoneAffinity(corev1.NodeSelectorOpNotIn, "us-central1-a"),
+			want:     []string{"spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms[0].matchExpressions[0]"},
+		},
+		{
+			name: "Nothing Allowed Without Bounds",
+			id:   3,
+			tols: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+			want: []string{"spec.tolerations[0].key"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, err := range tt.bounds.check(tt.tols, tt.selectors, tt.affinity, field.NewPath("spec")) {
+				got = append(got, err.Field)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got errors at %v, want %v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func setTestNamespaceOverrides(t *testing.T) {
+
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "tenant-a",
+				Annotations: map[string]string{
+					namespaceTolerationsAnnotation: `[{"key": "dedicated", "operator": "Equal", "value": "tenant-a", "effect": "NoSchedule"}, {"key": "node-role.kubernetes.io/control-plane", "operator": "Exists"}]`,
+					namespaceSelectorsAnnotation:   `{"cloud.google.com/gke-nodepool": "tenant-a-db", "node-type": "gpu", "topology.kubernetes.io/zone": "us-central1-a"}`,
+				},
+			},
+		},
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "tenant-b",
+				Annotations: map[string]string{
+					namespaceSelectorsAnnotation: `{"node-type": "tenant"}`,
+				},
+			},
+		},
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "tenant-c",
+				Annotations: map[string]string{
+					namespaceTolerationsAnnotation: `dedicated=tenant-c:NoSchedule`,
+				},
+			},
+		},
+	)
+	savedNamespaces, savedBounds := namespaces, namespaceBounds
+	namespaces = startTestNamespaceInformer(t, client)
+	namespaceBounds = &NamespaceBounds{
+		TolerationKeys: []string{"dedicated", "cloud.google.com/alloydb-host"},
+		NodeSelectors: map[string][]string{
+			"cloud.google.com/gke-nodepool": {},
+			"node-type":                     {"database", "tenant"},
+		},
+	}
+	t.Cleanup(func() {
+		namespaces, namespaceBounds = savedNamespaces, savedBounds
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+var nodeSelectors map[string]string
+
+// BuildSelectors loads the node selectors added to every pod when SELECTORS_CONFIG_FILE is set, the same file
+// the alloydb-nodeselector-mwh webhook reads, so a single webhook can place the pods with tolerations & selectors.
+func BuildSelectors() {
+	fileName := os.Getenv("SELECTORS_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("SELECTORS_CONFIG_PATH"), fileName)
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("selectors", "handlers.BuildSelectors():Error opening node selectors config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("selectors", "handlers.BuildSelectors():Error reading the node selectors data from the file:: %v", err)
+		return
+	}
+	if nodeSelectors, err = loadNodeSelectors(data); err != nil {
+		configFailed("selectors", "handlers.BuildSelectors():Error loading the node selectors data from the file %s:: %v", filePath, err)
+		return
+	}
+	configLoaded("selectors", filePath, data)
+	log.Info("handlers.BuildSelectors():Initialized the node selectors to be configured for the pod")
+
+}
+
+func loadNodeSelectors(data []byte) (map[string]string, error) {
+
+	selectors := map[string]string{}
+	validate := func() field.ErrorList { return validateNodeSelector(selectors, nil) }
+	if err := loadConfig(data, &selectors, validate); err != nil {
+		return nil, err
+	}
+	return selectors, nil
+
+}
+
+// nodeSelectorPatch merges the configured or role's & the matching rules' node selectors into the pod's, it's only patched
+// when the pod is created since the node selector can't change afterwards.
+func nodeSelectorPatch(req *mutationRequest) []patchOperation {
+
+	if req.ar.Request.Operation == v1beta1.Update {
+		return nil
+	}
+	// The namespace's selectors override the configured ones & the pod's override both
+	keep := mergeMaps(mergeMaps(placementSelectors(req), req.namespaceSelectors, MergePolicyEnforce), req.extraSelectors, MergePolicyEnforce)
+	enforce := map[string]string{}
+	for _, r := range req.rules {
+		if r.Policy == MergePolicyEnforce {
+			enforce = mergeMaps(enforce, r.NodeSelector, MergePolicyKeepExisting) // The earlier rule wins
+		} else {
+			keep = mergeMaps(keep, r.NodeSelector, MergePolicyKeepExisting)
+		}
+	}
+	if len(keep) == 0 && len(enforce) == 0 {
+		return nil
+	}
+	existing := req.pod.Spec.NodeSelector
+	combined := mergeMaps(mergeMaps(existing, keep, MergePolicyKeepExisting), enforce, MergePolicyEnforce)
+	if reflect.DeepEqual(combined, existing) {
+		return nil
+	}
+	return []patchOperation{{Op: "add", Path: "/spec/nodeSelector", Value: combined}}
+
+}
+
+func mergeMaps(existing, new map[string]string, policy MergePolicy) map[string]string {
+
+	result := make(map[string]string)
+	for k, val := range existing {
+		result[k] = val
+	}
+	for k, val := range new {
+		if _, ok := result[k]; !ok || policy == MergePolicyEnforce { // Only add unique keys unless enforced
+			result[k] = val
+		}
+	}
+	return result
+
+}
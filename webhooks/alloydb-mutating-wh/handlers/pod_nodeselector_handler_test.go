@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeMaps(t *testing.T) {
+	tests := []struct {
+		id       int
+		name     string
+		existing map[string]string
+		new      map[string]string
+		policy   MergePolicy
+		want     map[string]string
+	}{
+		{
+			name:     "Keep Existing Adds Unique Keys",
+			id:       0,
+			existing: map[string]string{"environment": "dev", "disk": "hdd"},
+			new:      map[string]string{"disk": "ssd", "node-type": "database"},
+			policy:   MergePolicyKeepExisting,
+			want:     map[string]string{"environment": "dev", "disk": "hdd", "node-type": "database"},
+		},
+		{
+			name:     "Enforce Overwrites Existing Keys",
+			id:       1,
+			existing: map[string]string{"environment": "dev", "disk": "hdd"},
+			new:      map[string]string{"disk": "ssd", "node-type": "database"},
+			policy:   MergePolicyEnforce,
+			want:     map[string]string{"environment": "dev", "disk": "ssd", "node-type": "database"},
+		},
+		{
+			name:     "Nil Maps",
+			id:       2,
+			existing: nil,
+			new:      nil,
+			policy:   MergePolicyKeepExisting,
+			want:     map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeMaps(tt.existing, tt.new, tt.policy)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::mergeMaps() = %v, want %v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func setTestNodeSelectors(t *testing.T) {
+
+	saved := nodeSelectors
+	nodeSelectors = map[string]string{
+		"disk":      "ssd",
+		"node-type": "database",
+	}
+	t.Cleanup(func() {
+		nodeSelectors = saved
+	})
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// The AlloyDB roles a pod is classified into, they key the placement & failover tolerations config.
+const (
+	RolePrimary    = "primary"
+	RoleStandby    = "standby"
+	RoleReadPool   = "readpool"
+	RolePgBouncer  = "pgbouncer"
+	RoleBackup     = "backup"
+	RoleMonitoring = "monitoring"
+	// RoleDatabase is the config key shared by the primary, standby & readpool roles, a more specific key wins.
+	RoleDatabase = "database"
+	defaultRole  = "default"
+)
+
+// Labels & owner kinds the operator puts on the pods it creates.
+const (
+	taskTypeLabel   = "alloydbomni.internal.dbadmin.goog/task-type"
+	haRoleLabel     = "dbs.internal.dbadmin.goog/ha-role"
+	dbInstanceLabel = "alloydbomni.dbadmin.goog/dbinstance" // Only on the pods of a readpool DBInstance
+	pgBouncerLabel  = "alloydbomni.dbadmin.goog/pgbouncer"
+)
+
+// RolePlacement replaces the tolerations & node selectors from TOLERATION_CONFIG_FILE & SELECTORS_CONFIG_FILE for the pods of a role.
+// A field it leaves out is taken from the next role key & from the configured ones last, an empty list or map clears it.
+type RolePlacement struct {
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+}
+
+var rolePlacements map[string]RolePlacement // Keyed by the pod role, RoleDatabase or defaultRole
+
+// BuildRolePlacements loads the per role placement when PLACEMENT_CONFIG_FILE is set, roles without an entry keep the
+// configured tolerations & node selectors.
+func BuildRolePlacements() {
+	fileName := os.Getenv("PLACEMENT_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("PLACEMENT_CONFIG_PATH"), fileName)
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("placement", "handlers.BuildRolePlacements():Error opening role placement config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("placement", "handlers.BuildRolePlacements():Error reading the role placement from the file:: %v", err)
+		return
+	}
+	if rolePlacements, err = loadRolePlacements(data); err != nil {
+		configFailed("placement", "handlers.BuildRolePlacements():Error loading the role placement from the file:: %v", err)
+		return
+	}
+	configLoaded("placement", filePath, data)
+	log.Infof("handlers.BuildRolePlacements():Initialized the placement for %d pod roles", len(rolePlacements))
+
+}
+
+func loadRolePlacements(data []byte) (map[string]RolePlacement, error) {
+
+	placements := map[string]RolePlacement{}
+	validate := func() field.ErrorList {
+		errs := field.ErrorList{}
+		for role, p := range placements {
+			if !knownRole(role) {
+				errs = append(errs, field.NotSupported(field.NewPath(role), role, roles))
+				continue
+			}
+			errs = append(errs, validateTolerations(p.Tolerations, field.NewPath(role).Child("tolerations"))...)
+			errs = append(errs, validateNodeSelector(p.NodeSelector, field.NewPath(role).Child("nodeSelector"))...)
+		}
+		return errs
+	}
+	if err := loadConfig(data, &placements, validate); err != nil {
+		return nil, err
+	}
+	return placements, nil
+
+}
+
+// roles are the keys the config can use for the pod roles.
+var roles = []string{RolePrimary, RoleStandby, RoleReadPool, RolePgBouncer, RoleBackup, RoleMonitoring, RoleDatabase, defaultRole}
+
+func knownRole(role string) bool {
+	return containsString(roles, role)
+}
+
+// podRole classifies the pod from the operator's labels first & its owner references second, pods the operator
+// didn't create end up in defaultRole.
+func podRole(pod *corev1.Pod) string {
+
+	switch pod.Labels[taskTypeLabel] {
+	case "database":
+		if _, ok := pod.Labels[dbInstanceLabel]; ok {
+			return RoleReadPool
+		}
+		if pod.Labels[haRoleLabel] == "Standby" {
+			return RoleStandby
+		}
+		return RolePrimary
+	case "monitoring":
+		return RoleMonitoring
+	case "backup":
+		return RoleBackup
+	case "pgbouncer":
+		return RolePgBouncer
+	}
+	if _, ok := pod.Labels[pgBouncerLabel]; ok {
+		return RolePgBouncer
+	}
+	for _, owner := range pod.OwnerReferences {
+		switch owner.Kind {
+		case "PgBouncer":
+			return RolePgBouncer
+		case "Backup", "InstanceBackup":
+			return RoleBackup
+		case "DBInstance":
+			return RoleReadPool
+		}
+	}
+	return defaultRole
+
+}
+
+// roleKeys is the order the config is looked up in for a role, from the most specific key to defaultRole.
+func roleKeys(role string) []string {
+	switch role {
+	case RolePrimary, RoleStandby, RoleReadPool:
+		return []string{role, RoleDatabase, defaultRole}
+	case defaultRole:
+		return []string{defaultRole}
+	}
+	return []string{role, defaultRole}
+}
+
+// placementTolerations returns a copy of the tolerations configured for the pod's role or the ones from
+// TOLERATION_CONFIG_FILE, the requests share those & appending to them would race.
+func placementTolerations(req *mutationRequest, tols []corev1.Toleration) []corev1.Toleration {
+	for _, key := range roleKeys(req.role) {
+		if p, ok := rolePlacements[key]; ok && p.Tolerations != nil {
+			return append([]corev1.Toleration{}, p.Tolerations...)
+		}
+	}
+	return append([]corev1.Toleration{}, tols...)
+}
+
+// placementSelectors returns the node selectors configured for the pod's role or the ones from SELECTORS_CONFIG_FILE.
+func placementSelectors(req *mutationRequest) map[string]string {
+	for _, key := range roleKeys(req.role) {
+		if p, ok := rolePlacements[key]; ok && p.NodeSelector != nil {
+			return p.NodeSelector
+		}
+	}
+	return nodeSelectors
+}
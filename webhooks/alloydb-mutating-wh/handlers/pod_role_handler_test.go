@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const testRolePlacements = `{
+	"database": {
+		"tolerations": [{"key": "dedicated", "operator": "Equal", "value": "alloydb", "effect": "NoSchedule"}],
+		"nodeSelector": {"cloud.google.com/gke-nodepool": "alloydb-db"}
+	},
+	"pgbouncer": {
+		"nodeSelector": {"cloud.google.com/gke-nodepool": "spot"}
+	},
+	"monitoring": {
+		"tolerations": [],
+		"nodeSelector": {"cloud.google.com/gke-nodepool": "spot"}
+	},
+	"backup": {
+		"tolerations": [{"key": "cloud.google.com/gke-spot", "operator": "Exists", "effect": "NoSchedule"}],
+		"nodeSelector": {"cloud.google.com/gke-nodepool": "spot"}
+	}
+}`
+
+func TestPodRole(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		pod  *corev1.Pod
+		want string
+	}{
+		{
+			name: "Primary",
+			id:   0,
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{taskTypeLabel: "database", haRoleLabel: "Primary"}}},
+			want: RolePrimary,
+		},
+		{
+			name: "Standby",
+			id:   1,
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{taskTypeLabel: "database", haRoleLabel: "Standby"}}},
+			want: RoleStandby,
+		},
+		{
+			name: "Readpool",
+			id:   2,
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{taskTypeLabel: "database", dbInstanceLabel: "readpool-sample"}}},
+			want: RoleReadPool,
+		},
+		{
+			name: "Monitoring",
+			id:   3,
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{taskTypeLabel: "monitoring"}}},
+			want: RoleMonitoring,
+		},
+		{
+			name: "PgBouncer Owner",
+			id:   4,
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{{Kind: "PgBouncer", Name: "mypgbouncer"}}}},
+			want: RolePgBouncer,
+		},
+		{
+			name: "Backup Owner",
+			id:   5,
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{{Kind: "InstanceBackup", Name: "backup1"}}}},
+			want: RoleBackup,
+		},
+		{
+			name: "Unrelated Pod",
+			id:   6,
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "debug"}}}},
+			want: defaultRole,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podRole(tt.pod); got != tt.want {
+				t.Errorf("\t%s\tTest ID=%d::podRole() = %s, want %s", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMutatePodRolePlacement(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		ar   *v1beta1.AdmissionReview
+		want *v1beta1.AdmissionResponse
+	}{
+		{
+			name: "Standby Uses Database Placement",
+			id:   0,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database", "dbs.internal.dbadmin.goog/ha-role": "Standby"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"dedicated","operator":"Equal","value":"alloydb","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"cloud.google.com/gke-nodepool":"alloydb-db"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Backup Runs On Spot Nodes",
+			id:   1,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "ownerReferences": [{"apiVersion": "alloydbomni.internal.dbadmin.goog/v1", "kind": "InstanceBackup", "name": "backup1", "uid": "4d1c1c6e-2b1a-4b8e-9a6f-0f1b2c3d4e5f"}]}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/gke-spot","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"cloud.google.com/gke-nodepool":"spot"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "PgBouncer Keeps The Configured Tolerations",
+			id:   2,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "pgbouncer"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"cloud.google.com/gke-nodepool":"spot"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Monitoring Clears The Tolerations",
+			id:   3,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "monitoring"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"add","path":"/spec/nodeSelector","value":{"cloud.google.com/gke-nodepool":"spot"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Other Pod Keeps The Configured Placement",
+			id:   4,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"disk":"ssd","node-type":"database"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+	}
+
+	setTestNodeSelectors(t)
+	setTestRolePlacements(t, testRolePlacements)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mutatePod(tt.ar, tolerations)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRolePlacements(t *testing.T) {
+	tests := []struct {
+		id      int
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "Valid Placement",
+			id:   0,
+			data: testRolePlacements,
+		},
+		{
+			name:    "Unknown Role",
+			id:      1,
+			data:    `{"replica": {"nodeSelector": {"cloud.google.com/gke-nodepool": "spot"}}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadRolePlacements([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("\t%s\tTest ID=%d::loadRolePlacements() error = %v, wantErr %v", failed, tt.id, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlacementTolerationsCopy(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		role string
+	}{
+		{
+			name: "Role Placement",
+			id:   0,
+			role: RoleBackup,
+		},
+		{
+			name: "Configured Tolerations",
+			id:   1,
+			role: defaultRole,
+		},
+	}
+
+	setTestRolePlacements(t, testRolePlacements)
+	configured := make([]corev1.Toleration, 1, 2) // Room to append in place
+	configured[0] = corev1.Toleration{Key: "cloud.google.com/alloydb-host", Operator: corev1.TolerationOpExists}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tols := placementTolerations(&mutationRequest{role: tt.role}, configured)
+			tols[0].Key = "changed"
+			_ = append(tols, corev1.Toleration{Key: "appended"})
+
+			if configured[0].Key != "cloud.google.com/alloydb-host" || configured[:2][1].Key != "" || rolePlacements[RoleBackup].Tolerations[0].Key != "cloud.google.com/gke-spot" {
+				t.Errorf("\t%s\tTest ID=%d::The shared tolerations were modified: %+v, %+v", failed, tt.id, configured, rolePlacements[RoleBackup])
+			}
+		})
+	}
+}
+
+func setTestRolePlacements(t *testing.T, data string) {
+
+	placements, err := loadRolePlacements([]byte(data))
+	if err != nil {
+		t.Fatalf("\t%s\tCould not load the test role placement:: %v", failed, err)
+	}
+	saved := rolePlacements
+	rolePlacements = placements
+	t.Cleanup(func() {
+		rolePlacements = saved
+	})
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// MergePolicy decides what happens when the pod already sets a field a rule wants to set.
+type MergePolicy string
+
+const (
+	// MergePolicyKeepExisting only fills in fields the pod left empty & leaves the ones it already sets as they are.
+	MergePolicyKeepExisting MergePolicy = "keep-existing"
+	// MergePolicyEnforce overwrites whatever the pod asked for with the value from the rule.
+	MergePolicyEnforce MergePolicy = "enforce"
+)
+
+// RuleEvaluation decides how many of the rules matching a pod are applied to it.
+type RuleEvaluation string
+
+const (
+	// RuleEvaluationMergeAll applies every matching rule, the earlier rule wins when two of them set the same field.
+	RuleEvaluationMergeAll RuleEvaluation = "merge-all"
+	// RuleEvaluationFirstMatch only applies the first matching rule.
+	RuleEvaluationFirstMatch RuleEvaluation = "first-match"
+)
+
+// PodRule applies its mutations to the pods matching all of its namespace, role & pod selectors, an empty selector matches everything.
+// The tolerations & node selectors come on top of the ones from TOLERATION_CONFIG_FILE & SELECTORS_CONFIG_FILE.
+type PodRule struct {
+	Name              string                `json:"name"`
+	Namespaces        []string              `json:"namespaces,omitempty"`
+	Roles             []string              `json:"roles,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	PodSelector       *metav1.LabelSelector `json:"podSelector,omitempty"`
+	Tolerations       []corev1.Toleration   `json:"tolerations,omitempty"`
+	NodeSelector      map[string]string     `json:"nodeSelector,omitempty"`
+	Affinity          *corev1.Affinity      `json:"affinity,omitempty"`
+	RuntimeClassName  string                `json:"runtimeClassName,omitempty"`
+	SchedulerName     string                `json:"schedulerName,omitempty"`
+	Policy            MergePolicy           `json:"policy,omitempty"`
+
+	namespaceSelector labels.Selector
+	podSelector       labels.Selector
+	onMatch           func() // Counts the matches of a PlacementPolicy
+}
+
+// PodRules is the layout of the file pointed to by RULES_CONFIG_PATH & RULES_CONFIG_FILE.
+type PodRules struct {
+	Evaluation RuleEvaluation `json:"evaluation,omitempty"`
+	Rules      []PodRule      `json:"rules"`
+}
+
+var podRules PodRules
+
+// BuildRules loads the pod rules when RULES_CONFIG_FILE is set & registers the mutators driven by them.
+func BuildRules() {
+	fileName := os.Getenv("RULES_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("RULES_CONFIG_PATH"), fileName)
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("rules", "handlers.BuildRules():Error opening pod rules config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("rules", "handlers.BuildRules():Error reading the pod rules from the file:: %v", err)
+		return
+	}
+	if podRules, err = loadRules(data); err != nil {
+		configFailed("rules", "handlers.BuildRules():Error loading the pod rules from the file:: %v", err)
+		return
+	}
+	configLoaded("rules", filePath, data)
+	for _, r := range podRules.Rules {
+		if r.NamespaceSelector != nil && namespaces == nil {
+			namespaces = newNamespaceGetter()
+		}
+	}
+	podMutators = append(podMutators, registeredPodMutator{runtimeMutator, mutateRuntimeAndScheduler})
+	log.Infof("handlers.BuildRules():Initialized %d pod rules to be matched against the pod with %s evaluation", len(podRules.Rules), podRules.Evaluation)
+
+}
+
+func loadRules(data []byte) (PodRules, error) {
+
+	config := PodRules{}
+	if err := loadConfig(data, &config, config.validate); err != nil {
+		return PodRules{}, err
+	}
+	if config.Evaluation == "" {
+		config.Evaluation = RuleEvaluationMergeAll
+	}
+	for i := range config.Rules {
+		if err := config.Rules[i].compile(); err != nil {
+			return PodRules{}, fmt.Errorf("rule %d (%s): %v", i, config.Rules[i].Name, err)
+		}
+	}
+	return config, nil
+
+}
+
+func (c *PodRules) validate() field.ErrorList {
+
+	errs := field.ErrorList{}
+	switch c.Evaluation {
+	case "", RuleEvaluationMergeAll, RuleEvaluationFirstMatch:
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("evaluation"), c.Evaluation, []string{string(RuleEvaluationMergeAll), string(RuleEvaluationFirstMatch)}))
+	}
+	for i := range c.Rules {
+		errs = append(errs, c.Rules[i].validate(field.NewPath("rules").Index(i))...)
+	}
+	return errs
+
+}
+
+// validate checks the rule as found at fldPath, compile() expects a valid rule.
+func (r *PodRule) validate(fldPath *field.Path) field.ErrorList {
+
+	errs := field.ErrorList{}
+	switch r.Policy {
+	case "", MergePolicyKeepExisting, MergePolicyEnforce:
+	default:
+		errs = append(errs, field.NotSupported(fldPath.Child("policy"), r.Policy, []string{string(MergePolicyKeepExisting), string(MergePolicyEnforce)}))
+	}
+	for i, role := range r.Roles {
+		if !knownRole(role) {
+			errs = append(errs, field.NotSupported(fldPath.Child("roles").Index(i), role, roles))
+		}
+	}
+	selectorOpts := metav1validation.LabelSelectorValidationOptions{}
+	if r.NamespaceSelector != nil {
+		errs = append(errs, metav1validation.ValidateLabelSelector(r.NamespaceSelector, selectorOpts, fldPath.Child("namespaceSelector"))...)
+	}
+	if r.PodSelector != nil {
+		errs = append(errs, metav1validation.ValidateLabelSelector(r.PodSelector, selectorOpts, fldPath.Child("podSelector"))...)
+	}
+	errs = append(errs, validateTolerations(r.Tolerations, fldPath.Child("tolerations"))...)
+	errs = append(errs, validateNodeSelector(r.NodeSelector, fldPath.Child("nodeSelector"))...)
+	return errs
+
+}
+
+func (r *PodRule) compile() error {
+
+	if r.Policy == "" {
+		r.Policy = MergePolicyKeepExisting
+	}
+	var err error
+	if r.namespaceSelector, err = selectorOrEverything(r.NamespaceSelector); err != nil {
+		return fmt.Errorf("invalid namespaceSelector: %v", err)
+	}
+	if r.podSelector, err = selectorOrEverything(r.PodSelector); err != nil {
+		return fmt.Errorf("invalid podSelector: %v", err)
+	}
+	return nil
+
+}
+
+func selectorOrEverything(s *metav1.LabelSelector) (labels.Selector, error) {
+	if s == nil {
+		return labels.Everything(), nil
+	}
+	return metav1.LabelSelectorAsSelector(s)
+}
+
+func (r *PodRule) matches(req *mutationRequest, ns *corev1.Namespace) bool {
+
+	if len(r.Namespaces) != 0 && !containsString(r.Namespaces, req.namespace) {
+		return false
+	}
+	if len(r.Roles) != 0 && !containsRole(r.Roles, req.role) {
+		return false
+	}
+	if r.NamespaceSelector != nil && (ns == nil || !r.namespaceSelector.Matches(labels.Set(ns.Labels))) {
+		return false
+	}
+	return r.podSelector.Matches(labels.Set(req.pod.Labels))
+
+}
+
+// matchingRules returns the rules matching the pod in the order they were configured followed by the namespace's
+// placement policies, only the first one for first-match evaluation. The namespace is only looked up when one of
+// the rules has a namespace selector.
+func matchingRules(req *mutationRequest) ([]*PodRule, error) {
+
+	candidates := make([]*PodRule, 0, len(podRules.Rules))
+	for i := range podRules.Rules {
+		candidates = append(candidates, &podRules.Rules[i])
+	}
+	if placementPolicies != nil {
+		candidates = append(candidates, placementPolicies.rules(req.namespace)...)
+	}
+	var ns *corev1.Namespace
+	matched := []*PodRule{}
+	for _, r := range candidates {
+		if r.NamespaceSelector != nil && ns == nil {
+			var err error
+			if ns, err = req.getNamespace(); err != nil {
+				return nil, fmt.Errorf("could not look up the namespace %s for the pod rules: %v", req.namespace, err)
+			}
+		}
+		if !r.matches(req, ns) {
+			continue
+		}
+		log.Infof("handlers.matchingRules():Pod rule %s matched the pod", r.Name)
+		if r.onMatch != nil {
+			r.onMatch()
+		}
+		matched = append(matched, r)
+		if podRules.Evaluation == RuleEvaluationFirstMatch {
+			break
+		}
+	}
+	return matched, nil
+
+}
+
+// ruleTolerations splits the tolerations to add by the policy they are added with, the configured ones are never enforced.
+func ruleTolerations(tols []corev1.Toleration, rules []*PodRule) ([]corev1.Toleration, []corev1.Toleration) {
+
+	keep := append([]corev1.Toleration{}, tols...)
+	enforce := []corev1.Toleration{}
+	for _, r := range rules {
+		if r.Policy == MergePolicyEnforce {
+			enforce = append(enforce, r.Tolerations...)
+		} else {
+			keep = append(keep, r.Tolerations...)
+		}
+	}
+	return keep, enforce
+
+}
+
+// mutateRuntimeAndScheduler sets the runtimeClassName & schedulerName from the first matching rule setting each of them.
+func mutateRuntimeAndScheduler(req *mutationRequest) ([]patchOperation, error) {
+
+	if req.ar.Request.Operation == v1beta1.Update { // Both fields are immutable once the pod exists
+		return nil, nil
+	}
+	ops := []patchOperation{}
+	for _, r := range req.rules {
+		if r.RuntimeClassName == "" {
+			continue
+		}
+		existing := req.pod.Spec.RuntimeClassName
+		if existing == nil || (r.Policy == MergePolicyEnforce && *existing != r.RuntimeClassName) {
+			ops = append(ops, patchOperation{Op: "add", Path: "/spec/runtimeClassName", Value: r.RuntimeClassName})
+		}
+		break
+	}
+	for _, r := range req.rules {
+		if r.SchedulerName == "" {
+			continue
+		}
+		existing := req.pod.Spec.SchedulerName
+		// The API server defaults the scheduler before the webhook is called, so the default counts as unset.
+		unset := existing == "" || existing == corev1.DefaultSchedulerName
+		if existing != r.SchedulerName && (unset || r.Policy == MergePolicyEnforce) {
+			ops = append(ops, patchOperation{Op: "add", Path: "/spec/schedulerName", Value: r.SchedulerName})
+		}
+		break
+	}
+	return ops, nil
+
+}
+
+// affinityPatch sets the node affinity, pod affinity & pod anti-affinity each from the first matching rule setting it.
+func affinityPatch(req *mutationRequest) []patchOperation {
+
+	if req.ar.Request.Operation == v1beta1.Update { // The affinity of a running pod is immutable
+		return nil
+	}
+	affinity := &corev1.Affinity{}
+	if req.pod.Spec.Affinity != nil {
+		affinity = req.pod.Spec.Affinity.DeepCopy()
+	}
+	var nodeSet, podSet, antiSet bool
+	changed := false
+	for _, r := range req.rules {
+		if r.Affinity == nil {
+			continue
+		}
+		enforce := r.Policy == MergePolicyEnforce
+		if r.Affinity.NodeAffinity != nil && !nodeSet {
+			nodeSet = true
+			if affinity.NodeAffinity == nil || (enforce && !reflect.DeepEqual(affinity.NodeAffinity, r.Affinity.NodeAffinity)) {
+				affinity.NodeAffinity, changed = r.Affinity.NodeAffinity, true
+			}
+		}
+		if r.Affinity.PodAffinity != nil && !podSet {
+			podSet = true
+			if affinity.PodAffinity == nil || (enforce && !reflect.DeepEqual(affinity.PodAffinity, r.Affinity.PodAffinity)) {
+				affinity.PodAffinity, changed = r.Affinity.PodAffinity, true
+			}
+		}
+		if r.Affinity.PodAntiAffinity != nil && !antiSet {
+			antiSet = true
+			if affinity.PodAntiAffinity == nil || (enforce && !reflect.DeepEqual(affinity.PodAntiAffinity, r.Affinity.PodAntiAffinity)) {
+				affinity.PodAntiAffinity, changed = r.Affinity.PodAntiAffinity, true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return []patchOperation{{Op: "add", Path: "/spec/affinity", Value: affinity}}
+
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsRole also matches the database roles against RoleDatabase.
+func containsRole(roles []string, role string) bool {
+	for _, key := range roleKeys(role) {
+		if key != defaultRole && containsString(roles, key) {
+			return true
+		}
+	}
+	return containsString(roles, role)
+}
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testRules = `{
+	"rules": [
+		{
+			"name": "sandboxed-tenants",
+			"namespaceSelector": {"matchLabels": {"tenant-tier": "untrusted"}},
+			"runtimeClassName": "gvisor",
+			"policy": "enforce"
+		},
+		{
+			"name": "bin-packed-databases",
+			"namespaces": ["fake-ns", "tenant-ns"],
+			"podSelector": {"matchLabels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}},
+			"runtimeClassName": "kata",
+			"schedulerName": "bin-packing-scheduler"
+		}
+	]
+}`
+
+func TestMutatePodRuntimeAndScheduler(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		ar   *v1beta1.AdmissionReview
+		want *v1beta1.AdmissionResponse
+	}{
+		{
+			name: "Database Pod Keeps Existing Runtime Class",
+			id:   0,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"runtimeClassName": "runc", "schedulerName": "default-scheduler", "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"add","path":"/spec/schedulerName","value":"bin-packing-scheduler"}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Untrusted Tenant Enforced Runtime Class",
+			id:   1,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"runtimeClassName": "runc", "schedulerName": "custom-scheduler", "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"add","path":"/spec/runtimeClassName","value":"gvisor"}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "No Matching Rule",
+			id:   2,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "monitoring"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+		{
+			name: "Pod Update",
+			id:   3,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-ns",
+					Operation: v1beta1.Update,
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+	}
+
+	setTestRules(t, testRules)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mutatePod(tt.ar, make([]corev1.Toleration, 0))
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+const testPlacementRules = `{
+	"evaluation": "%s",
+	"rules": [
+		{
+			"name": "tenant-a-databases",
+			"namespaces": ["tenant-a"],
+			"podSelector": {"matchLabels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}},
+			"tolerations": [{"key": "dedicated", "operator": "Equal", "value": "tenant-a", "effect": "NoSchedule"}],
+			"nodeSelector": {"cloud.google.com/gke-nodepool": "tenant-a-db"},
+			"policy": "enforce"
+		},
+		{
+			"name": "tenant-a",
+			"namespaces": ["tenant-a"],
+			"tolerations": [{"key": "spot", "operator": "Exists", "effect": "NoSchedule"}],
+			"nodeSelector": {"cloud.google.com/gke-nodepool": "tenant-a-shared", "disk": "ssd"}
+		}
+	]
+}`
+
+func TestMutatePodPlacementRules(t *testing.T) {
+	tests := []struct {
+		id         int
+		name       string
+		evaluation RuleEvaluation
+		ar         *v1beta1.AdmissionReview
+		want       *v1beta1.AdmissionResponse
+	}{
+		{
+			name:       "Merge All Matching Rules",
+			id:         0,
+			evaluation: RuleEvaluationMergeAll,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-a",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"nodeSelector": {"cloud.google.com/gke-nodepool": "default-pool"}, "tolerations": [{"key": "dedicated", "operator": "Exists"}], "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"dedicated","operator":"Equal","value":"tenant-a","effect":"NoSchedule"},{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"},{"key":"spot","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"cloud.google.com/gke-nodepool":"tenant-a-db","disk":"ssd","node-type":"database"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name:       "First Match Only",
+			id:         1,
+			evaluation: RuleEvaluationFirstMatch,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-a",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"dedicated","operator":"Equal","value":"tenant-a","effect":"NoSchedule"},{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"cloud.google.com/gke-nodepool":"tenant-a-db","disk":"ssd","node-type":"database"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name:       "First Match Falls Through To Second Rule",
+			id:         2,
+			evaluation: RuleEvaluationFirstMatch,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-a",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "monitoring"}}, "spec": {"nodeSelector": {"cloud.google.com/gke-nodepool": "default-pool"}, "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"},{"key":"spot","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/nodeSelector","value":{"cloud.google.com/gke-nodepool":"default-pool","disk":"ssd","node-type":"database"}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name:       "Other Namespace Only Gets Configured Placement",
+			id:         3,
+			evaluation: RuleEvaluationMergeAll,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"nodeSelector": {"disk": "ssd", "node-type": "database"}, "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name:       "Pod Update Only Adds Tolerations",
+			id:         4,
+			evaluation: RuleEvaluationMergeAll,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-a",
+					Operation: v1beta1.Update,
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"nodeSelector": {"cloud.google.com/gke-nodepool": "default-pool"}, "tolerations": [{"key": "dedicated", "operator": "Exists"}], "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"},{"key":"spot","operator":"Exists","effect":"NoSchedule"},{"key":"dedicated","operator":"Exists"}]}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name:       "Pod Update With Every Toleration Key",
+			id:         5,
+			evaluation: RuleEvaluationMergeAll,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "tenant-a",
+					Operation: v1beta1.Update,
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"tolerations": [{"key": "dedicated", "operator": "Exists"}, {"key": "cloud.google.com/alloydb-host", "operator": "Exists"}, {"key": "spot", "operator": "Exists"}], "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+	}
+
+	setTestNodeSelectors(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestRules(t, fmt.Sprintf(testPlacementRules, tt.evaluation))
+			got := mutatePod(tt.ar, tolerations)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		id        int
+		name      string
+		data      string
+		wantRules int
+		wantErr   bool
+	}{
+		{
+			name:      "Valid Rules",
+			id:        0,
+			data:      testRules,
+			wantRules: 2,
+		},
+		{
+			name:    "Unknown Policy",
+			id:      1,
+			data:    `{"rules": [{"name": "bad", "schedulerName": "custom", "policy": "override"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Pod Selector",
+			id:      2,
+			data:    `{"rules": [{"name": "bad", "podSelector": {"matchExpressions": [{"key": "app", "operator": "Near"}]}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "Unknown Evaluation",
+			id:      4,
+			data:    `{"evaluation": "best-match", "rules": []}`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid JSON",
+			id:      3,
+			data:    `{"rules": [`,
+			wantErr: true,
+		},
+		{
+			name:    "Unknown Role",
+			id:      5,
+			data:    `{"rules": [{"name": "bad", "roles": ["replica"], "schedulerName": "custom"}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadRules([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("\t%s\tTest ID=%d::loadRules() error = %v, wantErr %v", failed, tt.id, err, tt.wantErr)
+				return
+			}
+			if len(got.Rules) != tt.wantRules {
+				t.Errorf("\t%s\tTest ID=%d::loadRules() returned %d rules, want %d", failed, tt.id, len(got.Rules), tt.wantRules)
+			}
+			for _, r := range got.Rules {
+				if r.Policy == "" {
+					t.Errorf("\t%s\tTest ID=%d::loadRules() left the policy of rule %s empty", failed, tt.id, r.Name)
+				}
+			}
+		})
+	}
+}
+
+// setTestRules registers the rule driven mutators against a fake client for the duration of the test.
+func setTestRules(t *testing.T, data string) {
+
+	rules, err := loadRules([]byte(data))
+	if err != nil {
+		t.Fatalf("\t%s\tCould not load the test rules: %v", failed, err)
+	}
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "tenant-ns",
+				Labels: map[string]string{"tenant-tier": "untrusted"},
+			},
+		},
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "fake-ns",
+			},
+		},
+	)
+	savedNamespaces, savedMutators, savedRules := namespaces, podMutators, podRules
+	namespaces = startTestNamespaceInformer(t, client)
+	podMutators = []registeredPodMutator{{runtimeMutator, mutateRuntimeAndScheduler}}
+	podRules = rules
+	t.Cleanup(func() {
+		namespaces, podMutators, podRules = savedNamespaces, savedMutators, savedRules
+	})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	log "k8s.io/klog/v2"
+)
+
+const (
+	sccUIDRangeAnnotation           = "openshift.io/sa.scc.uid-range"
+	sccSupplementalGroupsAnnotation = "openshift.io/sa.scc.supplemental-groups"
+)
+
+// idRange is an inclusive block of UIDs or GIDs as allocated by OpenShift to a namespace.
+type idRange struct {
+	min int64
+	max int64
+}
+
+// BuildOpenShiftMode registers the security context mutator when OPENSHIFT_MODE is set to true, so that
+// runAsUser, runAsGroup and fsGroup land inside the UID & GID ranges OpenShift allocated to the namespace.
+func BuildOpenShiftMode() {
+	mode := os.Getenv("OPENSHIFT_MODE")
+	if mode == "" {
+		return
+	}
+	enabled, err := strconv.ParseBool(mode)
+	if err != nil {
+		configFailed("openshift", "handlers.BuildOpenShiftMode():Invalid value %q for OPENSHIFT_MODE:: %v", mode, err)
+		return
+	}
+	if !enabled {
+		return
+	}
+	if namespaces == nil {
+		namespaces = newNamespaceGetter()
+	}
+	podMutators = append(podMutators, registeredPodMutator{securityContextMutator, mutateSecurityContext})
+	log.Info("handlers.BuildOpenShiftMode():Enabled the OpenShift SCC aware security context mutation for the pod")
+
+}
+
+func mutateSecurityContext(req *mutationRequest) ([]patchOperation, error) {
+
+	if req.ar.Request.Operation == v1beta1.Update { // The security context of a running pod is immutable
+		return nil, nil
+	}
+	pod, nsName := req.pod, req.namespace
+	ns, err := req.getNamespace()
+	if err != nil {
+		return nil, fmt.Errorf("could not look up the namespace %s for the OpenShift SCC ranges: %v", nsName, err)
+	}
+	uidAnnotation, ok := ns.Annotations[sccUIDRangeAnnotation]
+	if !ok {
+		log.Infof("handlers.mutateSecurityContext():Namespace %s has no %s annotation, leaving the security context as is", nsName, sccUIDRangeAnnotation)
+		return nil, nil
+	}
+	uids, err := parseIDRange(uidAnnotation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation on the namespace %s: %v", sccUIDRangeAnnotation, nsName, err)
+	}
+	gids := uids // OpenShift falls back to the UID range when there are no supplemental groups
+	if groupAnnotation, ok := ns.Annotations[sccSupplementalGroupsAnnotation]; ok {
+		if gids, err = parseIDRange(groupAnnotation); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation on the namespace %s: %v", sccSupplementalGroupsAnnotation, nsName, err)
+		}
+	}
+
+	ops := []patchOperation{}
+	podContext := &corev1.PodSecurityContext{}
+	if pod.Spec.SecurityContext != nil {
+		podContext = pod.Spec.SecurityContext.DeepCopy()
+	}
+	changed := fitID(&podContext.RunAsUser, uids, true)
+	changed = fitID(&podContext.RunAsGroup, gids, true) || changed
+	changed = fitID(&podContext.FSGroup, gids, true) || changed
+	if changed {
+		ops = append(ops, patchOperation{Op: "add", Path: "/spec/securityContext", Value: podContext})
+	}
+	// Container level values win over the pod level ones, so they are only rewritten when set & out of range.
+	ops = append(ops, containerSecurityContextPatches("initContainers", pod.Spec.InitContainers, uids, gids)...)
+	ops = append(ops, containerSecurityContextPatches("containers", pod.Spec.Containers, uids, gids)...)
+	return ops, nil
+
+}
+
+func containerSecurityContextPatches(field string, containers []corev1.Container, uids, gids idRange) []patchOperation {
+
+	ops := []patchOperation{}
+	for i, c := range containers {
+		if c.SecurityContext == nil {
+			continue
+		}
+		sc := c.SecurityContext.DeepCopy()
+		changed := fitID(&sc.RunAsUser, uids, false)
+		changed = fitID(&sc.RunAsGroup, gids, false) || changed
+		if changed {
+			ops = append(ops, patchOperation{Op: "add", Path: fmt.Sprintf("/spec/%s/%d/securityContext", field, i), Value: sc})
+		}
+	}
+	return ops
+
+}
+
+// fitID moves the ID to the start of the range when it falls outside of it, or fills it in when unset & fill is true.
+func fitID(id **int64, r idRange, fill bool) bool {
+
+	if *id == nil && !fill {
+		return false
+	}
+	if *id != nil && r.contains(**id) {
+		return false
+	}
+	start := r.min
+	*id = &start
+	return true
+
+}
+
+func (r idRange) contains(id int64) bool {
+	return id >= r.min && id <= r.max
+}
+
+// parseIDRange parses the first block of an OpenShift range annotation, written either as <start>/<size> or <start>-<end>.
+func parseIDRange(value string) (idRange, error) {
+
+	block := strings.TrimSpace(strings.Split(value, ",")[0])
+	if i := strings.Index(block, "/"); i > 0 {
+		start, err := strconv.ParseInt(block[:i], 10, 64)
+		if err != nil {
+			return idRange{}, err
+		}
+		size, err := strconv.ParseInt(block[i+1:], 10, 64)
+		if err != nil {
+			return idRange{}, err
+		}
+		if size <= 0 {
+			return idRange{}, fmt.Errorf("range size must be positive, got %d", size)
+		}
+		return idRange{min: start, max: start + size - 1}, nil
+	}
+	if i := strings.Index(block, "-"); i > 0 {
+		start, err := strconv.ParseInt(block[:i], 10, 64)
+		if err != nil {
+			return idRange{}, err
+		}
+		end, err := strconv.ParseInt(block[i+1:], 10, 64)
+		if err != nil {
+			return idRange{}, err
+		}
+		if end < start {
+			return idRange{}, fmt.Errorf("range end %d is lower than the start %d", end, start)
+		}
+		return idRange{min: start, max: end}, nil
+	}
+	return idRange{}, fmt.Errorf("expected <start>/<size> or <start>-<end>, got %q", value)
+
+}
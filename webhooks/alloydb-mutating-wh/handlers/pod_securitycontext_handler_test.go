@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMutatePodSecurityContext(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		tols []corev1.Toleration
+		ar   *v1beta1.AdmissionReview
+		want *v1beta1.AdmissionResponse
+	}{
+		{
+			name: "Pod Without Security Context",
+			id:   0,
+			tols: make([]corev1.Toleration, 0),
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "openshift-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"add","path":"/spec/securityContext","value":{"runAsUser":1000650000,"runAsGroup":1000660000,"fsGroup":1000660000}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Hardcoded Container UID Out Of Range",
+			id:   1,
+			tols: tolerations,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "openshift-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"securityContext": {"runAsUser": 1000650010, "runAsGroup": 1000660010, "fsGroup": 2000}, "containers": [{"name": "fake-container", "securityContext": {"runAsUser": 1001, "runAsNonRoot": true}}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"}]},{"op":"add","path":"/spec/securityContext","value":{"runAsUser":1000650010,"runAsGroup":1000660010,"fsGroup":1000660000}},{"op":"add","path":"/spec/containers/0/securityContext","value":{"runAsUser":1000650000,"runAsNonRoot":true}}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Security Context Already In Range",
+			id:   2,
+			tols: make([]corev1.Toleration, 0),
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "openshift-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"securityContext": {"runAsUser": 1000659999, "runAsGroup": 1000660000, "fsGroup": 1000660000}, "initContainers": [{"name": "fake-init", "securityContext": {"runAsGroup": 1000669999}}], "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+		{
+			name: "Namespace Without SCC Annotations",
+			id:   3,
+			tols: make([]corev1.Toleration, 0),
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "fake-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container", "securityContext": {"runAsUser": 1001}}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+		{
+			name: "Unknown Namespace",
+			id:   4,
+			tols: tolerations,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "missing-ns",
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: false,
+				Result: &metav1.Status{
+					Message: `could not look up the namespace missing-ns for the OpenShift SCC ranges: namespace "missing-ns" not found`,
+				},
+			},
+		},
+		{
+			name: "Pod Update",
+			id:   5,
+			tols: make([]corev1.Toleration, 0),
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Namespace: "openshift-ns",
+					Operation: v1beta1.Update,
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod"}, "spec": {"containers": [{"name": "fake-container", "securityContext": {"runAsUser": 1001}}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+	}
+
+	setTestOpenShiftMode(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mutatePod(tt.ar, tt.tols)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIDRange(t *testing.T) {
+	tests := []struct {
+		id      int
+		name    string
+		value   string
+		want    idRange
+		wantErr bool
+	}{
+		{
+			name:  "Start And Size",
+			id:    0,
+			value: "1000650000/10000",
+			want:  idRange{min: 1000650000, max: 1000659999},
+		},
+		{
+			name:  "Start And End",
+			id:    1,
+			value: "1000650000-1000650099",
+			want:  idRange{min: 1000650000, max: 1000650099},
+		},
+		{
+			name:  "Multiple Blocks",
+			id:    2,
+			value: "1000650000/10000,1000700000/10000",
+			want:  idRange{min: 1000650000, max: 1000659999},
+		},
+		{
+			name:    "Zero Size",
+			id:      3,
+			value:   "1000650000/0",
+			wantErr: true,
+		},
+		{
+			name:    "Garbage",
+			id:      4,
+			value:   "restricted",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIDRange(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("\t%s\tTest ID=%d::parseIDRange() error = %v, wantErr %v", failed, tt.id, err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("\t%s\tTest ID=%d::parseIDRange() = %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+// setTestOpenShiftMode registers the security context mutator against a fake client for the duration of the test.
+func setTestOpenShiftMode(t *testing.T) {
+
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "openshift-ns",
+				Annotations: map[string]string{
+					sccUIDRangeAnnotation:           "1000650000/10000",
+					sccSupplementalGroupsAnnotation: "1000660000/10000",
+				},
+			},
+		},
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "fake-ns",
+			},
+		},
+	)
+	savedNamespaces, savedMutators := namespaces, podMutators
+	namespaces = startTestNamespaceInformer(t, client)
+	podMutators = []registeredPodMutator{{securityContextMutator, mutateSecurityContext}}
+	t.Cleanup(func() {
+		namespaces, podMutators = savedNamespaces, savedMutators
+	})
+}
@@ -10,6 +10,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	log "k8s.io/klog/v2"
 
@@ -18,36 +19,160 @@ import (
 
 type AdmitFunc func(*v1beta1.AdmissionReview, []corev1.Toleration) *v1beta1.AdmissionResponse
 
+// podMutator returns the JSON patch operations for one part of the pod spec other than the tolerations & node selectors.
+// Mutators are registered by the Build functions at start up and run in registration order.
+type podMutator func(*mutationRequest) ([]patchOperation, error)
+
+// mutationRequest carries what mutatePod works out once per admission request for the mutators.
+type mutationRequest struct {
+	ar        *v1beta1.AdmissionReview
+	pod       *corev1.Pod
+	namespace string
+	ns        *corev1.Namespace // Looked up on demand with getNamespace()
+	role      string            // AlloyDB role of the pod, see podRole()
+	rules     []*PodRule        // Rules matching the pod, in the order they were configured
+
+	namespaceTolerations []corev1.Toleration // Asked for by the namespace's annotations within namespaceBounds
+	namespaceSelectors   map[string]string
+	extraTolerations     []corev1.Toleration // Asked for by the pod's annotations & found in the allowlist
+	extraSelectors       map[string]string
+	warnings             []string // Explain the decisions taken for the pod back to the client
+}
+
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// FailoverTolerationSeconds replaces the 300s the DefaultTolerationSeconds admission plugin gives every pod for the
+// node.kubernetes.io/not-ready & node.kubernetes.io/unreachable NoExecute taints, a nil value leaves the toleration alone.
+type FailoverTolerationSeconds struct {
+	NotReady    *int64 `json:"notReady,omitempty"`
+	Unreachable *int64 `json:"unreachable,omitempty"`
+}
+
 var tolerations []corev1.Toleration
 
+var failoverTolerationSeconds map[string]FailoverTolerationSeconds // Keyed by the pod role, RoleDatabase or defaultRole
+
+// registeredPodMutator is a podMutator along with the name DRY_RUN_MUTATORS knows it by.
+type registeredPodMutator struct {
+	name   string
+	mutate podMutator
+}
+
+var podMutators []registeredPodMutator
+
 func Routes() {
 	http.HandleFunc("/mutate", func(w http.ResponseWriter, r *http.Request) {
 		serve(w, r, mutatePod)
 	})
 	log.Info("handlers.Routes():Registered the handler for the path /mutate")
+	routeAdmissions(mutatingRoutes)
+	routeAdmissions(validatingRoutes)
+	http.HandleFunc("/metrics", serveMetrics)
+	log.Info("handlers.Routes():Registered the handler for the path /metrics")
+	http.HandleFunc("/readyz", serveReady)
+	log.Info("handlers.Routes():Registered the handler for the path /readyz")
+	if debugToken != "" {
+		http.HandleFunc("/debug/config", serveDebugConfig)
+		log.Info("handlers.Routes():Registered the handler for the path /debug/config")
+	}
 
 }
 
 func BuildTolerations() {
 	path := os.Getenv("TOLERATION_CONFIG_PATH")
 	fileName := os.Getenv("TOLERATION_CONFIG_FILE")
+	if fileName == "" {
+		configFailed("tolerations", "handlers.BuildTolerations():TOLERATION_CONFIG_FILE is not set")
+		return
+	}
 	filePath := filepath.Join(path, fileName)
 	configFile, err := os.Open(filePath)
 	if err != nil {
-		log.Fatalf(fmt.Sprintf("handlers.BuildTolerations():Error opening tolerations config file %s", os.Getenv("TOLERATION_CONFIG_PATH")), err)
+		configFailed("tolerations", "handlers.BuildTolerations():Error opening tolerations config file %s:: %v", filePath, err)
+		return
 	}
 	defer configFile.Close()
 	data, err := io.ReadAll(configFile)
 	if err != nil {
-		log.Fatalf("handlers.BuildTolerations():Error reading the toleration data from the file:: %v", err)
+		configFailed("tolerations", "handlers.BuildTolerations():Error reading the toleration data from the file:: %v", err)
+		return
 	}
-	if err = json.Unmarshal(data, &tolerations); err != nil {
-		log.Fatalf("handlers.BuildTolerations():Error unmarshalling the toleration data from the file:: %v", err)
+	if tolerations, err = loadTolerations(data); err != nil {
+		configFailed("tolerations", "handlers.BuildTolerations():Error loading the toleration data from the file %s:: %v", filePath, err)
+		return
 	}
+	configLoaded("tolerations", filePath, data)
 	log.Info("handlers.BuildTolerations():Initialized the tolerations to be configured for the pod")
 
 }
 
+// BuildFailoverTolerations loads the per role tolerationSeconds for the node failure taints when FAILOVER_TOLERATIONS_CONFIG_FILE is set.
+func BuildFailoverTolerations() {
+	fileName := os.Getenv("FAILOVER_TOLERATIONS_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("FAILOVER_TOLERATIONS_CONFIG_PATH"), fileName)
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("failover", "handlers.BuildFailoverTolerations():Error opening failover tolerations config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("failover", "handlers.BuildFailoverTolerations():Error reading the failover tolerations from the file:: %v", err)
+		return
+	}
+	if failoverTolerationSeconds, err = loadFailoverTolerations(data); err != nil {
+		configFailed("failover", "handlers.BuildFailoverTolerations():Error loading the failover tolerations from the file %s:: %v", filePath, err)
+		return
+	}
+	configLoaded("failover", filePath, data)
+	log.Info("handlers.BuildFailoverTolerations():Initialized the node failure tolerationSeconds to be configured for the pod")
+
+}
+
+func loadTolerations(data []byte) ([]corev1.Toleration, error) {
+
+	tols := []corev1.Toleration{}
+	validate := func() field.ErrorList { return validateTolerations(tols, nil) }
+	if err := loadConfig(data, &tols, validate); err != nil {
+		return nil, err
+	}
+	return tols, nil
+
+}
+
+func loadFailoverTolerations(data []byte) (map[string]FailoverTolerationSeconds, error) {
+
+	config := map[string]FailoverTolerationSeconds{}
+	validate := func() field.ErrorList {
+		errs := field.ErrorList{}
+		for role, seconds := range config {
+			if !knownRole(role) {
+				errs = append(errs, field.NotSupported(field.NewPath(role), role, roles))
+			}
+			if seconds.NotReady != nil && *seconds.NotReady < 0 {
+				errs = append(errs, field.Invalid(field.NewPath(role).Child("notReady"), *seconds.NotReady, "must not be negative"))
+			}
+			if seconds.Unreachable != nil && *seconds.Unreachable < 0 {
+				errs = append(errs, field.Invalid(field.NewPath(role).Child("unreachable"), *seconds.Unreachable, "must not be negative"))
+			}
+		}
+		return errs
+	}
+	if err := loadConfig(data, &config, validate); err != nil {
+		return nil, err
+	}
+	return config, nil
+
+}
+
 func serve(w http.ResponseWriter, r *http.Request, admit AdmitFunc) {
 	if r.Method != http.MethodPost {
 		if r.Header.Get("User-Agent") == "Kubelet" {
@@ -85,7 +210,7 @@ func serve(w http.ResponseWriter, r *http.Request, admit AdmitFunc) {
 		http.Error(w, fmt.Sprintf("Could not unmarshall AdmissionReview from the request body is empty:: %v", err), http.StatusBadRequest)
 		return
 	}
-	log.Infof("handlers.serve():Received a valid AdmissionReview for mutating the pod UID = %s", addmissionReview.Request.UID)
+	log.Infof("handlers.serve():Received a valid AdmissionReview to %s the %s UID = %s", addmissionReview.Request.Operation, addmissionReview.Request.Kind.Kind, addmissionReview.Request.UID)
 
 	admissionResponse := admit(&addmissionReview, tolerations)
 	addmissionReview.Response = admissionResponse
@@ -106,6 +231,9 @@ func serve(w http.ResponseWriter, r *http.Request, admit AdmitFunc) {
 func mutatePod(ar *v1beta1.AdmissionReview, tols []corev1.Toleration) *v1beta1.AdmissionResponse {
 
 	log.Info("handlers.mutatePod():Starting to add AlloyDB Omninodepool specific tolerations to the pod")
+	if resp := configFailureResponse(ar, "pod was not mutated", podConfigs...); resp != nil {
+		return resp
+	}
 	raw := ar.Request.Object.Raw
 	pod := corev1.Pod{}
 	if err := json.Unmarshal(raw, &pod); err != nil {
@@ -128,29 +256,102 @@ func mutatePod(ar *v1beta1.AdmissionReview, tols []corev1.Toleration) *v1beta1.A
 		}
 	}
 
-	if len(tols) == 0 {
+	skip, reason := skipMutation(&pod)
+	if skip {
+		log.Infof("handlers.mutatePod():Skipping the pod:: %s", reason)
 		return &v1beta1.AdmissionResponse{
-			UID:     ar.Request.UID,
-			Allowed: true,
+			UID:      ar.Request.UID,
+			Allowed:  true,
+			Warnings: []string{reason},
 			Result: &metav1.Status{
 				Status: "Success",
 			},
 		}
+	}
 
+	req := &mutationRequest{ar: ar, pod: &pod, namespace: ar.Request.Namespace, role: podRole(&pod)}
+	if req.namespace == "" {
+		req.namespace = pod.Namespace
 	}
-	existing := pod.Spec.Tolerations  // Existing tolerations
-	combined := []corev1.Toleration{} // Existing & newly added combined
-	if len(existing) == 0 {           // When no existing tolerations, combined = newly added only
-		combined = tols
-	} else {
-		for _, t := range tols {
-			if !exists(t, existing) {
-				combined = append(combined, t)
+	if reason != "" {
+		req.warnings = append(req.warnings, reason)
+	}
+	extraPlacement(req)
+	if err := namespacePlacement(req); err != nil {
+		log.Errorf("handlers.mutatePod():Could not read the namespace overrides:: %v", err)
+		return &v1beta1.AdmissionResponse{
+			UID:     ar.Request.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+	rules, err := matchingRules(req)
+	if err != nil {
+		log.Errorf("handlers.mutatePod():Could not match the pod rules:: %v", err)
+		return &v1beta1.AdmissionResponse{
+			UID:     ar.Request.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+	req.rules = rules
+
+	mutations := []podMutation{}
+	// The namespace's tolerations override the configured ones & the pod's override both
+	base := overrideTolerations(overrideTolerations(placementTolerations(req, tols), req.namespaceTolerations), req.extraTolerations)
+	keep, enforce := ruleTolerations(base, req.rules)
+	combined := pod.Spec.Tolerations // Existing & newly added combined
+	changed := len(keep) != 0 || len(enforce) != 0
+	if ar.Request.Operation == v1beta1.Update {
+		// A pod update may only add tolerations, so the pod's ones stay as they are even when enforced
+		keep, enforce = append(enforce, keep...), nil
+		changed = false
+	}
+	if len(keep) != 0 || len(enforce) != 0 {
+		combined = mergeTolerations(pod.Spec.Tolerations, keep, enforce)
+		changed = changed || len(combined) != len(pod.Spec.Tolerations)
+	}
+	combined, adjusted := adjustFailoverTolerations(req, combined)
+	if changed || adjusted {
+		mutations = append(mutations, podMutation{tolerationsMutator, []patchOperation{{Op: "replace", Path: "/spec/tolerations", Value: combined}}})
+	}
+	mutations = append(mutations, podMutation{nodeSelectorMutator, nodeSelectorPatch(req)}, podMutation{affinityMutator, affinityPatch(req)})
+	for _, m := range podMutators {
+		mutation, err := m.mutate(req)
+		if err != nil {
+			log.Errorf("handlers.mutatePod():Could not mutate the pod:: %v", err)
+			return &v1beta1.AdmissionResponse{
+				UID:     ar.Request.UID,
+				Allowed: false,
+				Result: &metav1.Status{
+					Message: err.Error(),
+				},
 			}
 		}
-		combined = append(combined, existing...)
+		mutations = append(mutations, podMutation{m.name, mutation})
+	}
+	ops, auditAnnotations := dryRun(req, mutations)
+	if len(ops) != 0 {
+		ops = append(ops, configHashPatch(&pod)...)
+	}
+
+	if len(ops) == 0 {
+		return &v1beta1.AdmissionResponse{
+			UID:              ar.Request.UID,
+			Allowed:          true,
+			Warnings:         req.warnings,
+			AuditAnnotations: auditAnnotations,
+			Result: &metav1.Status{
+				Status: "Success",
+			},
+		}
+
 	}
-	patch, err := constructPatch(combined)
+	patch, err := constructPatch(ops)
 	if err != nil {
 		log.Errorf("handlers.mutatePod():Could not create a patch for adding tolerations to the pod:: %v", err)
 		return &v1beta1.AdmissionResponse{
@@ -163,9 +364,11 @@ func mutatePod(ar *v1beta1.AdmissionReview, tols []corev1.Toleration) *v1beta1.A
 	}
 	log.Info("handlers.mutatePod():Added the AlloyDB Omni nodepool specific tolerations to the pod & returning the patch")
 	return &v1beta1.AdmissionResponse{
-		UID:     ar.Request.UID,
-		Allowed: true,
-		Patch:   patch,
+		UID:              ar.Request.UID,
+		Allowed:          true,
+		Warnings:         req.warnings,
+		AuditAnnotations: auditAnnotations,
+		Patch:            patch,
 		PatchType: func() *v1beta1.PatchType {
 			pt := v1beta1.PatchTypeJSONPatch
 			return &pt
@@ -173,6 +376,30 @@ func mutatePod(ar *v1beta1.AdmissionReview, tols []corev1.Toleration) *v1beta1.A
 	}
 }
 
+// mergeTolerations puts the enforced tolerations in place of the pod's ones with the same key & adds the
+// others only when the pod has no toleration with their key, the added ones come before the existing ones.
+func mergeTolerations(existing, keep, enforce []corev1.Toleration) []corev1.Toleration {
+
+	combined := []corev1.Toleration{}
+	for _, t := range enforce {
+		if !exists(t, combined) {
+			combined = append(combined, t)
+		}
+	}
+	for _, t := range keep {
+		if !exists(t, combined) && !exists(t, existing) {
+			combined = append(combined, t)
+		}
+	}
+	for _, t := range existing {
+		if !exists(t, enforce) {
+			combined = append(combined, t)
+		}
+	}
+	return combined
+
+}
+
 func exists(add corev1.Toleration, existing []corev1.Toleration) bool {
 
 	for _, e := range existing {
@@ -184,17 +411,73 @@ func exists(add corev1.Toleration, existing []corev1.Toleration) bool {
 
 }
 
-func constructPatch(combined []corev1.Toleration) ([]byte, error) {
+// adjustFailoverTolerations sets the tolerationSeconds configured for the pod's role on the not-ready & unreachable
+// tolerations, updating the ones already on the pod rather than skipping them like exists() does.
+func adjustFailoverTolerations(req *mutationRequest, tols []corev1.Toleration) ([]corev1.Toleration, bool) {
+
+	if len(failoverTolerationSeconds) == 0 || req.ar.Request.Operation == v1beta1.Update { // Only set when the pod is created
+		return tols, false
+	}
+	var seconds FailoverTolerationSeconds
+	found := false
+	for _, key := range roleKeys(req.role) {
+		if seconds, found = failoverTolerationSeconds[key]; found {
+			break
+		}
+	}
+	if !found {
+		return tols, false
+	}
+	adjusted := append([]corev1.Toleration{}, tols...) // Never touch the configured tolerations or the pod's slice
+	changed := setTolerationSeconds(&adjusted, corev1.TaintNodeNotReady, seconds.NotReady)
+	changed = setTolerationSeconds(&adjusted, corev1.TaintNodeUnreachable, seconds.Unreachable) || changed
+	if !changed {
+		return tols, false
+	}
+	return adjusted, true
+
+}
+
+func setTolerationSeconds(tols *[]corev1.Toleration, key string, seconds *int64) bool {
 
-	patch := []interface{}{
-		map[string]interface{}{
-			"op":    "replace",
-			"path":  "/spec/tolerations",
-			"value": combined,
-		},
+	if seconds == nil {
+		return false
+	}
+	for i := range *tols {
+		t := &(*tols)[i]
+		if t.Key != key {
+			continue
+		}
+		if t.Effect == "" { // Already tolerates the taint forever, the pod asked for it explicitly
+			return false
+		}
+		if t.Effect != corev1.TaintEffectNoExecute {
+			continue
+		}
+		if t.TolerationSeconds == nil { // Tolerates it forever too, DefaultTolerationSeconds never adds such a toleration
+			return false
+		}
+		if *t.TolerationSeconds == *seconds {
+			return false
+		}
+		s := *seconds
+		t.TolerationSeconds = &s
+		return true
 	}
+	s := *seconds
+	*tols = append(*tols, corev1.Toleration{
+		Key:               key,
+		Operator:          corev1.TolerationOpExists,
+		Effect:            corev1.TaintEffectNoExecute,
+		TolerationSeconds: &s,
+	})
+	return true
+
+}
+
+func constructPatch(ops []patchOperation) ([]byte, error) {
 
-	patchBytes, err := json.Marshal(patch)
+	patchBytes, err := json.Marshal(ops)
 	if err != nil {
 		return nil, err
 	}
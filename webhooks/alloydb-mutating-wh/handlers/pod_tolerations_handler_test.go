@@ -324,28 +324,185 @@ func TestMutatePod(t *testing.T) {
 	}
 }
 
+func TestMutatePodFailoverTolerations(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		tols []corev1.Toleration
+		ar   *v1beta1.AdmissionReview
+		want *v1beta1.AdmissionResponse
+	}{
+		{
+			name: "Database Pod With Default Node Failure Tolerations",
+			id:   0,
+			tols: make([]corev1.Toleration, 0),
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID: types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "namespace": "fake-ns", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"tolerations": [{"key": "node.kubernetes.io/not-ready", "operator": "Exists", "effect": "NoExecute", "tolerationSeconds": 300}, {"key": "node.kubernetes.io/unreachable", "operator": "Exists", "effect": "NoExecute", "tolerationSeconds": 300}], "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"node.kubernetes.io/not-ready","operator":"Exists","effect":"NoExecute","tolerationSeconds":20},{"key":"node.kubernetes.io/unreachable","operator":"Exists","effect":"NoExecute","tolerationSeconds":30}]}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Other Pod Falls Back To Default Role",
+			id:   1,
+			tols: tolerations,
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID: types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "namespace": "fake-ns"}, "spec": {"tolerations": [{"key": "node.kubernetes.io/unreachable", "operator": "Exists", "effect": "NoExecute", "tolerationSeconds": 300}], "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Patch:   []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"cloud.google.com/alloydb-host","operator":"Exists","effect":"NoSchedule"},{"key":"node.kubernetes.io/unreachable","operator":"Exists","effect":"NoExecute","tolerationSeconds":300},{"key":"node.kubernetes.io/not-ready","operator":"Exists","effect":"NoExecute","tolerationSeconds":120}]}]`),
+				PatchType: func() *v1beta1.PatchType {
+					pt := v1beta1.PatchTypeJSONPatch
+					return &pt
+				}(),
+			},
+		},
+		{
+			name: "Seconds Already Set",
+			id:   2,
+			tols: make([]corev1.Toleration, 0),
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID: types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "namespace": "fake-ns", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"tolerations": [{"key": "node.kubernetes.io/not-ready", "operator": "Exists", "effect": "NoExecute", "tolerationSeconds": 20}, {"key": "node.kubernetes.io/unreachable", "operator": "Exists"}], "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+		{
+			name: "NoExecute Without Seconds Kept",
+			id:   3,
+			tols: make([]corev1.Toleration, 0),
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID: types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "namespace": "fake-ns", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"tolerations": [{"key": "node.kubernetes.io/not-ready", "operator": "Exists", "effect": "NoExecute"}, {"key": "node.kubernetes.io/unreachable", "operator": "Exists", "effect": "NoExecute", "tolerationSeconds": 30}], "containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+		{
+			name: "Pod Update",
+			id:   4,
+			tols: make([]corev1.Toleration, 0),
+			ar: &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Operation: v1beta1.Update,
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fake-pod", "namespace": "fake-ns", "labels": {"alloydbomni.internal.dbadmin.goog/task-type": "database"}}, "spec": {"containers": [{"name": "fake-container"}]}}`),
+					},
+				},
+			},
+			want: &v1beta1.AdmissionResponse{
+				UID:     types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+				Allowed: true,
+				Result: &metav1.Status{
+					Status: "Success",
+				},
+			},
+		},
+	}
+
+	setTestFailoverTolerations(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mutatePod(tt.ar, tt.tols)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\t%s\tTest ID=%d::Got response %+v, want %+v", failed, tt.id, got, tt.want)
+			}
+		})
+	}
+	if tolerations[0].TolerationSeconds != nil || len(tolerations) != 1 {
+		t.Errorf("\t%s\tThe configured tolerations were modified: %+v", failed, tolerations)
+	}
+}
+
 func TestConstructPatch(t *testing.T) {
 	tests := []struct {
-		name        string
-		tolerations []corev1.Toleration
-		want        []byte
+		name string
+		ops  []patchOperation
+		want []byte
 	}{
 		{
 			name: "Construct Patch",
-			tolerations: []corev1.Toleration{
+			ops: []patchOperation{
 				{
-					Key:      "key1",
-					Operator: corev1.TolerationOpEqual,
-					Value:    "value1",
+					Op:   "replace",
+					Path: "/spec/tolerations",
+					Value: []corev1.Toleration{
+						{
+							Key:      "key1",
+							Operator: corev1.TolerationOpEqual,
+							Value:    "value1",
+						},
+					},
 				},
 			},
 			want: []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"key1","operator":"Equal","value":"value1"}]}]`),
 		},
+		{
+			name: "Construct Patch Multiple Operations",
+			ops: []patchOperation{
+				{
+					Op:   "replace",
+					Path: "/spec/tolerations",
+					Value: []corev1.Toleration{
+						{
+							Key:      "key1",
+							Operator: corev1.TolerationOpExists,
+						},
+					},
+				},
+				{
+					Op:    "add",
+					Path:  "/spec/securityContext",
+					Value: &corev1.PodSecurityContext{},
+				},
+			},
+			want: []byte(`[{"op":"replace","path":"/spec/tolerations","value":[{"key":"key1","operator":"Exists"}]},{"op":"add","path":"/spec/securityContext","value":{}}]`),
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := constructPatch(tt.tolerations)
+			got, err := constructPatch(tt.ops)
 			if err != nil {
 				t.Errorf("\t%s\tconstructPatch() error = %v", failed, err)
 			}
@@ -365,3 +522,16 @@ func setDefaultTolerations() {
 		},
 	}
 }
+
+func setTestFailoverTolerations(t *testing.T) {
+
+	seconds := func(s int64) *int64 { return &s }
+	saved := failoverTolerationSeconds
+	failoverTolerationSeconds = map[string]FailoverTolerationSeconds{
+		"database":  {NotReady: seconds(20), Unreachable: seconds(30)},
+		defaultRole: {NotReady: seconds(120)},
+	}
+	t.Cleanup(func() {
+		failoverTolerationSeconds = saved
+	})
+}
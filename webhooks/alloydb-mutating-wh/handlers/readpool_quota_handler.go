@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// Annotations a cluster admin sets on a namespace to replace its readpool quota from the config.
+const (
+	readPoolNodesAnnotation = "alloydb.cloud.google.com/readpool-max-nodes" // Integer
+	readPoolCPUAnnotation   = "alloydb.cloud.google.com/readpool-max-cpu"   // Quantity like 16 or 8000m
+)
+
+// ReadPoolQuota limits the readpool DBInstances of a namespace, summed over their nodes, a nil limit isn't enforced.
+type ReadPoolQuota struct {
+	Nodes *int64             `json:"nodes,omitempty"`
+	CPU   *resource.Quantity `json:"cpu,omitempty"`
+}
+
+// ReadPoolQuotas is the layout of the file pointed to by READPOOL_QUOTA_CONFIG_PATH & READPOOL_QUOTA_CONFIG_FILE.
+type ReadPoolQuotas struct {
+	// Default applies to the namespaces without an entry in Namespaces.
+	Default    ReadPoolQuota            `json:"default,omitempty"`
+	Namespaces map[string]ReadPoolQuota `json:"namespaces,omitempty"`
+}
+
+var readPoolQuotas *ReadPoolQuotas
+
+// BuildReadPoolQuotas loads the readpool quotas & serves the DBInstance validator at /validate/dbinstance when
+// READPOOL_QUOTA_CONFIG_FILE is set.
+func BuildReadPoolQuotas() {
+	fileName := os.Getenv("READPOOL_QUOTA_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("READPOOL_QUOTA_CONFIG_PATH"), fileName)
+	registerValidator("/validate/dbinstance", dbInstanceKind, validateDBInstance, "readpool-quota", "namespaces", "alloydb")
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("readpool-quota", "handlers.BuildReadPoolQuotas():Error opening readpool quota config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("readpool-quota", "handlers.BuildReadPoolQuotas():Error reading the readpool quotas from the file:: %v", err)
+		return
+	}
+	if readPoolQuotas, err = loadReadPoolQuotas(data); err != nil {
+		configFailed("readpool-quota", "handlers.BuildReadPoolQuotas():Error loading the readpool quotas from the file %s:: %v", filePath, err)
+		return
+	}
+	configLoaded("readpool-quota", filePath, data)
+	if namespaces == nil {
+		namespaces = newNamespaceGetter()
+	}
+	watchAlloyDB(dbInstanceResource)
+	log.Info("handlers.BuildReadPoolQuotas():Enabled the readpool quota validation")
+
+}
+
+func loadReadPoolQuotas(data []byte) (*ReadPoolQuotas, error) {
+
+	quotas := &ReadPoolQuotas{}
+	if err := loadConfig(data, quotas, quotas.validate); err != nil {
+		return nil, err
+	}
+	return quotas, nil
+
+}
+
+func (q *ReadPoolQuotas) validate() field.ErrorList {
+
+	errs := q.Default.validate(field.NewPath("default"))
+	for ns, quota := range q.Namespaces {
+		errs = append(errs, quota.validate(field.NewPath("namespaces").Key(ns))...)
+	}
+	return errs
+
+}
+
+func (q ReadPoolQuota) validate(fldPath *field.Path) field.ErrorList {
+
+	errs := field.ErrorList{}
+	if q.Nodes != nil && *q.Nodes < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("nodes"), *q.Nodes, "must not be negative"))
+	}
+	if q.CPU != nil && q.CPU.Sign() < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("cpu"), q.CPU.String(), "must not be negative"))
+	}
+	return errs
+
+}
+
+// quota returns the readpool quota of the namespace, its annotations override the config one by one.
+func (q *ReadPoolQuotas) quota(req *validationRequest) (ReadPoolQuota, error) {
+
+	quota, ok := q.Namespaces[req.namespace]
+	if !ok {
+		quota = q.Default
+	}
+	ns, err := req.getNamespace()
+	if err != nil {
+		return quota, fmt.Errorf("could not look up the namespace %s for its readpool quota: %v", req.namespace, err)
+	}
+	if value, ok := ns.Annotations[readPoolNodesAnnotation]; ok {
+		if nodes, err := strconv.ParseInt(value, 10, 64); err != nil || nodes < 0 {
+			req.warn("ignored the annotation %s=%q of the namespace %s, it must be a number of nodes", readPoolNodesAnnotation, value, req.namespace)
+		} else {
+			quota.Nodes = &nodes
+		}
+	}
+	if value, ok := ns.Annotations[readPoolCPUAnnotation]; ok {
+		if cpu, err := resource.ParseQuantity(value); err != nil || cpu.Sign() < 0 {
+			req.warn("ignored the annotation %s=%q of the namespace %s, it must be a CPU quantity", readPoolCPUAnnotation, value, req.namespace)
+		} else {
+			quota.CPU = &cpu
+		}
+	}
+	return quota, nil
+
+}
+
+// readPoolUsage returns the nodes & CPU of a readpool DBInstance, nothing for the other instance types.
+func readPoolUsage(instance *DBInstance) (int64, resource.Quantity) {
+
+	cpu := resource.Quantity{}
+	if instance.Spec.InstanceType != readPoolInstanceType {
+		return 0, cpu
+	}
+	nodes := int64(instance.Spec.NodeCount)
+	if nodes == 0 {
+		nodes = 1 // The operator's default
+	}
+	if instance.Spec.Resources.CPU != nil {
+		cpu.Add(*instance.Spec.Resources.CPU)
+		cpu.Mul(nodes)
+	}
+	return nodes, cpu
+
+}
+
+// validateDBInstance denies the readpool DBInstances taking the readpools of the namespace over its quota, an update
+// that doesn't grow the readpool is let through to bring a namespace back under a lowered quota.
+func validateDBInstance(req *validationRequest) (field.ErrorList, error) {
+
+	if req.ar.Request.Operation != v1beta1.Create && req.ar.Request.Operation != v1beta1.Update {
+		return nil, nil
+	}
+	instance := &DBInstance{}
+	if err := json.Unmarshal(req.ar.Request.Object.Raw, instance); err != nil {
+		return nil, err
+	}
+	nodes, cpu := readPoolUsage(instance)
+	if nodes == 0 {
+		return nil, nil
+	}
+	oldNodes, oldCPU := int64(0), resource.Quantity{}
+	if req.ar.Request.Operation == v1beta1.Update && len(req.ar.Request.OldObject.Raw) != 0 {
+		old := &DBInstance{}
+		if err := json.Unmarshal(req.ar.Request.OldObject.Raw, old); err != nil {
+			return nil, err
+		}
+		oldNodes, oldCPU = readPoolUsage(old)
+	}
+	quota, err := readPoolQuotas.quota(req)
+	if err != nil {
+		return nil, err
+	}
+	if quota.Nodes == nil && quota.CPU == nil {
+		return nil, nil
+	}
+
+	instances, err := alloyDB.listDBInstances(req.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the DBInstances: %v", err)
+	}
+	usedNodes, usedCPU := int64(0), resource.Quantity{}
+	for _, other := range instances {
+		if other.Name == instance.Name {
+			continue // Replaced by the one admitted
+		}
+		n, c := readPoolUsage(other)
+		usedNodes += n
+		usedCPU.Add(c)
+	}
+
+	specPath := field.NewPath("spec")
+	errs := field.ErrorList{}
+	if quota.Nodes != nil && usedNodes+nodes > *quota.Nodes && nodes > oldNodes {
+		errs = append(errs, field.Forbidden(specPath.Child("nodeCount"), fmt.Sprintf(
+			"the readpools of the namespace %s would use %d nodes with the %d of this DBInstance, over the quota of %d nodes (%d in use)",
+			req.namespace, usedNodes+nodes, nodes, *quota.Nodes, usedNodes)))
+	}
+	total := usedCPU.DeepCopy()
+	total.Add(cpu)
+	if quota.CPU != nil && total.Cmp(*quota.CPU) > 0 && cpu.Cmp(oldCPU) > 0 {
+		errs = append(errs, field.Forbidden(specPath.Child("resources", "cpu"), fmt.Sprintf(
+			"the readpools of the namespace %s would use %s CPU with the %s of this DBInstance, over the quota of %s CPU (%s in use)",
+			req.namespace, total.String(), cpu.String(), quota.CPU.String(), usedCPU.String())))
+	}
+	return errs, nil
+
+}
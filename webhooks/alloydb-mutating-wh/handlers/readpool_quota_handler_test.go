@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateDBInstance(t *testing.T) {
+	tests := []struct {
+		id           int
+		name         string
+		namespace    string
+		operation    v1beta1.Operation
+		object       string
+		oldObject    string
+		allowed      bool
+		wantFields   []string
+		wantMessage  string
+		wantWarnings int
+	}{
+		{
+			name:      "Readpool Within The Default Quota",
+			id:        0,
+			namespace: "db",
+			operation: v1beta1.Create,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"name": "rp-2"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "dbcluster-sample"}, "nodeCount": 1, "resources": {"cpu": 2, "memory": "6Gi"}}}`,
+			allowed:   true,
+		},
+		{
+			name:        "Too Many Nodes",
+			id:          1,
+			namespace:   "db",
+			operation:   v1beta1.Create,
+			object:      `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"name": "rp-2"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "dbcluster-sample"}, "nodeCount": 3, "resources": {"cpu": 1, "memory": "6Gi"}}}`,
+			allowed:     false,
+			wantFields:  []string{"spec.nodeCount"},
+			wantMessage: "would use 5 nodes with the 3 of this DBInstance, over the quota of 4 nodes (2 in use)",
+		},
+		{
+			name:        "Too Much CPU",
+			id:          2,
+			namespace:   "db",
+			operation:   v1beta1.Create,
+			object:      `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"name": "rp-2"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "dbcluster-sample"}, "nodeCount": 2, "resources": {"cpu": "2500m", "memory": "6Gi"}}}`,
+			allowed:     false,
+			wantFields:  []string{"spec.resources.cpu"},
+			wantMessage: "would use 9 CPU with the 5 of this DBInstance, over the quota of 8 CPU (4 in use)",
+		},
+		{
+			name:      "Scaling Up Within The Quota",
+			id:        3,
+			namespace: "db",
+			operation: v1beta1.Update,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"name": "dbcluster-sample-rp-1"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "dbcluster-sample"}, "nodeCount": 4, "resources": {"cpu": 2, "memory": "6Gi"}}}`,
+			oldObject: `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"name": "dbcluster-sample-rp-1"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "dbcluster-sample"}, "nodeCount": 2, "resources": {"cpu": 2, "memory": "6Gi"}}}`,
+			allowed:   true,
+		},
+		{
+			name:      "Scaling Down Over An Annotated Quota",
+			id:        4,
+			namespace: "batch",
+			operation: v1beta1.Update,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"name": "batch-rp"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "batch"}, "nodeCount": 2, "resources": {"cpu": 1}}}`,
+			oldObject: `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"name": "batch-rp"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "batch"}, "nodeCount": 3, "resources": {"cpu": 1}}}`,
+			allowed:   true,
+		},
+		{
+			name:        "Annotated Quota",
+			id:          5,
+			namespace:   "batch",
+			operation:   v1beta1.Create,
+			object:      `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"name": "batch-rp-2"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "batch"}, "resources": {"cpu": 1}}}`,
+			allowed:     false,
+			wantFields:  []string{"spec.nodeCount"},
+			wantMessage: "over the quota of 1 nodes (3 in use)",
+		},
+		{
+			name:      "Namespace Quota From The Config",
+			id:        6,
+			namespace: "analytics",
+			operation: v1beta1.Create,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"name": "rp-1"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "warehouse"}, "nodeCount": 6, "resources": {"cpu": 4}}}`,
+			allowed:   true,
+		},
+		{
+			name:         "Invalid Namespace Annotation",
+			id:           7,
+			namespace:    "lab",
+			operation:    v1beta1.Create,
+			object:       `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"name": "rp-1"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "lab"}, "nodeCount": 1, "resources": {"cpu": 1}}}`,
+			allowed:      true,
+			wantWarnings: 1,
+		},
+	}
+
+	setTestReadPoolQuotas(t)
+	admit := validatingRoutes["/validate/dbinstance"]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      "rp",
+					Namespace: tt.namespace,
+					Operation: tt.operation,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+					OldObject: runtime.RawExtension{Raw: []byte(tt.oldObject)},
+				},
+			}
+			got := admit(ar, nil)
+
+			if got.Allowed != tt.allowed {
+				t.Fatalf("\t%s\tTest ID=%d::Got allowed %t, want %t:: %+v", failed, tt.id, got.Allowed, tt.allowed, got.Result)
+			}
+			if len(got.Warnings) != tt.wantWarnings {
+				t.Errorf("\t%s\tTest ID=%d::Got the warnings %v, want %d", failed, tt.id, got.Warnings, tt.wantWarnings)
+			}
+			if tt.allowed {
+				return
+			}
+			fields := []string{}
+			for _, cause := range got.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %s", failed, tt.id, fields, tt.wantFields, got.Result.Message)
+			}
+			if !strings.Contains(got.Result.Message, tt.wantMessage) {
+				t.Errorf("\t%s\tTest ID=%d::Got the message %q, want it to contain %q", failed, tt.id, got.Result.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+// setTestReadPoolQuotas allows 4 readpool nodes & 8 CPU per namespace, 10 nodes & 40 CPU in analytics & 1 node in
+// batch through its annotation. db has a readpool of 2 nodes with 2 CPU each, batch one of 3 nodes.
+func setTestReadPoolQuotas(t *testing.T) {
+
+	quotas, err := loadReadPoolQuotas([]byte(`
+default: {nodes: 4, cpu: "8"}
+namespaces:
+  analytics: {nodes: 10, cpu: "40"}
+`))
+	if err != nil {
+		t.Fatalf("\t%s\tCould not load the readpool quotas:: %v", failed, err)
+	}
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "db"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "analytics"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "batch", Annotations: map[string]string{readPoolNodesAnnotation: "1"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "lab", Annotations: map[string]string{readPoolNodesAnnotation: "lots"}}},
+	)
+	setTestAlloyDB(t,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"namespace": "db", "name": "dbcluster-sample-rp-1"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "dbcluster-sample"}, "nodeCount": 2, "resources": {"cpu": 2, "memory": "6Gi"}}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBInstance", "metadata": {"namespace": "batch", "name": "batch-rp"}, "spec": {"instanceType": "ReadPool", "dbcParent": {"name": "batch"}, "nodeCount": 3, "resources": {"cpu": 1}}}`,
+	)
+	savedQuotas, savedNamespaces, savedRoute := readPoolQuotas, namespaces, validatingRoutes["/validate/dbinstance"]
+	readPoolQuotas, namespaces = quotas, startTestNamespaceInformer(t, client)
+	registerValidator("/validate/dbinstance", dbInstanceKind, validateDBInstance)
+	t.Cleanup(func() {
+		readPoolQuotas, namespaces = savedQuotas, savedNamespaces
+		if savedRoute == nil {
+			delete(validatingRoutes, "/validate/dbinstance")
+		} else {
+			validatingRoutes["/validate/dbinstance"] = savedRoute
+		}
+	})
+
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/api/admission/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// BuildReplicationChecks serves the Replication validator at /validate/replication when REPLICATION_CHECKS is set to
+// true, it watches the DBClusters & the Replications.
+func BuildReplicationChecks() {
+	value := os.Getenv("REPLICATION_CHECKS")
+	if value == "" {
+		return
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		configFailed("replication", "handlers.BuildReplicationChecks():Invalid value %q for REPLICATION_CHECKS:: %v", value, err)
+		return
+	}
+	if !enabled {
+		return
+	}
+	watchAlloyDB(dbClusterResource, replicationResource)
+	registerValidator("/validate/replication", replicationKind, validateReplication, "replication", "alloydb")
+	log.Info("handlers.BuildReplicationChecks():Enabled the Replication validation")
+
+}
+
+// validateReplication denies the Replications that aren't either an upstream or a downstream, refer to a missing
+// DBCluster, replicate from their own DBCluster or add a second upstream to a DBCluster. The DBCluster is only looked up
+// when a Replication is created or moved to another one, the Replications of a deleted DBCluster can still be updated.
+func validateReplication(req *validationRequest) (field.ErrorList, error) {
+
+	if req.ar.Request.Operation != v1beta1.Create && req.ar.Request.Operation != v1beta1.Update {
+		return nil, nil
+	}
+	replication := &Replication{}
+	if err := json.Unmarshal(req.ar.Request.Object.Raw, replication); err != nil {
+		return nil, err
+	}
+	if replication.DeletionTimestamp != nil {
+		return nil, nil // The operator removes its finalizer, maybe after the DBCluster is gone
+	}
+	var old *Replication // The Replication before an update
+	if req.ar.Request.Operation == v1beta1.Update && len(req.ar.Request.OldObject.Raw) != 0 {
+		old = &Replication{}
+		if err := json.Unmarshal(req.ar.Request.OldObject.Raw, old); err != nil {
+			return nil, err
+		}
+	}
+	specPath := field.NewPath("spec")
+	spec := replication.Spec
+	errs := field.ErrorList{}
+
+	switch {
+	case spec.Upstream == nil && spec.Downstream == nil:
+		errs = append(errs, field.Required(specPath.Child("upstream"), "a Replication must set either upstream or downstream"))
+	case spec.Upstream != nil && spec.Downstream != nil:
+		errs = append(errs, field.Forbidden(specPath.Child("downstream"), "a Replication must set either upstream or downstream, not both"))
+	}
+	if d := spec.Downstream; d != nil {
+		errs = append(errs, checkDownstream(d, req.namespace, spec.DBCluster.Name, specPath.Child("downstream"))...)
+	}
+
+	clusterPath := specPath.Child("dbcluster", "name")
+	name := spec.DBCluster.Name
+	if name == "" {
+		return append(errs, field.Required(clusterPath, "")), nil
+	}
+	if old == nil || old.Spec.DBCluster.Name != name {
+		if _, err := alloyDB.getDBCluster(req.namespace, name); apierrors.IsNotFound(err) {
+			errs = append(errs, field.NotFound(clusterPath, name))
+		} else if err != nil {
+			return nil, fmt.Errorf("could not look up the DBCluster %s: %v", name, err)
+		}
+	}
+
+	if spec.Upstream != nil && (old == nil || old.Spec.Upstream == nil || old.Spec.DBCluster.Name != name) {
+		replications, err := alloyDB.listReplications(req.namespace)
+		if err != nil {
+			return nil, fmt.Errorf("could not list the Replications: %v", err)
+		}
+		for _, r := range replications {
+			if r.Name != replication.Name && r.Spec.DBCluster.Name == name && r.Spec.Upstream != nil {
+				errs = append(errs, field.Duplicate(specPath.Child("upstream"), fmt.Sprintf("the DBCluster %s already has the upstream Replication %s", name, r.Name)))
+				break
+			}
+		}
+	}
+	return errs, nil
+
+}
+
+func checkDownstream(d *DownstreamReplication, namespace, cluster string, fldPath *field.Path) field.ErrorList {
+
+	errs := field.ErrorList{}
+	if d.Host == "" {
+		errs = append(errs, field.Required(fldPath.Child("host"), "the address of the upstream DBCluster"))
+	} else if cluster != "" && ownService(d.Host, namespace, cluster) {
+		errs = append(errs, field.Invalid(fldPath.Child("host"), d.Host, fmt.Sprintf("points at the DBCluster %s itself, a downstream must replicate from another DBCluster", cluster)))
+	}
+	if d.Port < 1 || d.Port > 65535 {
+		errs = append(errs, field.Invalid(fldPath.Child("port"), d.Port, "must be between 1 and 65535"))
+	}
+	if d.Username == "" {
+		errs = append(errs, field.Required(fldPath.Child("username"), ""))
+	}
+	if d.Password.Name == "" {
+		errs = append(errs, field.Required(fldPath.Child("password", "name"), "the Secret holding the password of the replication user"))
+	}
+	return errs
+
+}
+
+// ownService tells if the host is one of the services the operator creates for the DBCluster, al-<name>-rw-ilb &
+// al-<name>-rw-elb, by name or by a DNS name within the namespace.
+func ownService(host, namespace, cluster string) bool {
+
+	service, domain, _ := strings.Cut(strings.TrimSuffix(host, "."), ".")
+	if service != fmt.Sprintf("al-%s-rw-ilb", cluster) && service != fmt.Sprintf("al-%s-rw-elb", cluster) {
+		return false
+	}
+	return domain == "" || domain == namespace || strings.HasPrefix(domain, namespace+".svc")
+
+}
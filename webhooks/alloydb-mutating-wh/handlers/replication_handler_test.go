@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestValidateReplication(t *testing.T) {
+	tests := []struct {
+		id         int
+		name       string
+		object     string
+		oldObject  string // Updated when set, created otherwise
+		allowed    bool
+		wantFields []string
+	}{
+		{
+			name:    "Upstream Of A Cluster Without One",
+			id:      0,
+			object:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-upstream-sample"}, "spec": {"dbcluster": {"name": "dbcluster-sample"}, "upstream": {}}}`,
+			allowed: true,
+		},
+		{
+			name:       "Second Upstream",
+			id:         1,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-upstream-2"}, "spec": {"dbcluster": {"name": "prod"}, "upstream": {}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.upstream"},
+		},
+		{
+			name:    "Downstream From Another Cluster",
+			id:      2,
+			object:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-downstream-sample"}, "spec": {"dbcluster": {"name": "dbcluster-sample"}, "downstream": {"host": "10.10.10.10", "port": 5432, "username": "alloydbreplica", "password": {"name": "ha-rep-pw-dbcluster-sample"}, "replicationSlotName": "dbcluster_sample_replication_upstream_sample", "control": "setup"}}}`,
+			allowed: true,
+		},
+		{
+			name:       "Downstream From Its Own Cluster",
+			id:         3,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-downstream-sample"}, "spec": {"dbcluster": {"name": "dbcluster-sample"}, "downstream": {"host": "al-dbcluster-sample-rw-ilb.db.svc.cluster.local", "port": 5432, "username": "alloydbreplica", "password": {"name": "ha-rep-pw-dbcluster-sample"}, "control": "setup"}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.downstream.host"},
+		},
+		{
+			name:       "Downstream Of A Missing Cluster Without A Password",
+			id:         4,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-downstream-sample"}, "spec": {"dbcluster": {"name": "dbcluster-smaple"}, "downstream": {"host": "10.10.10.10", "port": 5432, "username": "alloydbreplica", "control": "setup"}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.downstream.password.name", "spec.dbcluster.name"},
+		},
+		{
+			name:       "Upstream And Downstream",
+			id:         5,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample"}, "spec": {"dbcluster": {"name": "dbcluster-sample"}, "upstream": {}, "downstream": {"host": "10.10.10.10", "port": 5432, "username": "alloydbreplica", "password": {"name": "ha-rep-pw-dbcluster-sample"}}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.downstream"},
+		},
+		{
+			name:       "Neither Upstream Nor Downstream",
+			id:         6,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample"}, "spec": {"dbcluster": {"name": "dbcluster-sample"}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.upstream"},
+		},
+		{
+			name:       "Downstream Updated To A Second Upstream",
+			id:         7,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample"}, "spec": {"dbcluster": {"name": "prod"}, "upstream": {}}}`,
+			oldObject:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample"}, "spec": {"dbcluster": {"name": "prod"}, "downstream": {"host": "10.10.10.10", "port": 5432, "username": "alloydbreplica", "password": {"name": "ha-rep-pw-prod"}}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.upstream"},
+		},
+		{
+			name:       "Upstream Moved To A Cluster With One",
+			id:         8,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample"}, "spec": {"dbcluster": {"name": "prod"}, "upstream": {}}}`,
+			oldObject:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample"}, "spec": {"dbcluster": {"name": "dbcluster-sample"}, "upstream": {}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.upstream"},
+		},
+		{
+			name:      "Existing Upstream Updated",
+			id:        9,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "prod-upstream", "labels": {"team": "dba"}}, "spec": {"dbcluster": {"name": "prod"}, "upstream": {}}}`,
+			oldObject: `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "prod-upstream"}, "spec": {"dbcluster": {"name": "prod"}, "upstream": {}}}`,
+			allowed:   true,
+		},
+		{
+			name:      "Update Of A Replication Whose Cluster Is Gone",
+			id:        10,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample", "labels": {"team": "dba"}}, "spec": {"dbcluster": {"name": "deleted"}, "upstream": {}}}`,
+			oldObject: `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample"}, "spec": {"dbcluster": {"name": "deleted"}, "upstream": {}}}`,
+			allowed:   true,
+		},
+		{
+			name:      "Finalizer Removal From A Replication Whose Cluster Is Gone",
+			id:        11,
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample", "deletionTimestamp": "2026-10-17T12:00:00Z"}, "spec": {"dbcluster": {"name": "deleted"}, "upstream": {}}}`,
+			oldObject: `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample", "deletionTimestamp": "2026-10-17T12:00:00Z", "finalizers": ["alloydbomni.dbadmin.goog/finalizer"]}, "spec": {"dbcluster": {"name": "deleted"}, "upstream": {}}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Replication Moved To A Missing Cluster",
+			id:         12,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample"}, "spec": {"dbcluster": {"name": "dbcluster-smaple"}, "upstream": {}}}`,
+			oldObject:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"name": "replication-sample"}, "spec": {"dbcluster": {"name": "dbcluster-sample"}, "upstream": {}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.dbcluster.name"},
+		},
+	}
+
+	setTestReplicationChecks(t)
+	admit := validatingRoutes["/validate/replication"]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      "replication-sample",
+					Namespace: "db",
+					Operation: v1beta1.Create,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+				},
+			}
+			if tt.oldObject != "" {
+				ar.Request.Operation = v1beta1.Update
+				ar.Request.OldObject = runtime.RawExtension{Raw: []byte(tt.oldObject)}
+			}
+			got := admit(ar, nil)
+
+			if got.Allowed != tt.allowed {
+				t.Fatalf("\t%s\tTest ID=%d::Got allowed %t, want %t:: %+v", failed, tt.id, got.Allowed, tt.allowed, got.Result)
+			}
+			if tt.allowed {
+				return
+			}
+			fields := []string{}
+			for _, cause := range got.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %s", failed, tt.id, fields, tt.wantFields, got.Result.Message)
+			}
+		})
+	}
+}
+
+func TestOwnService(t *testing.T) {
+	tests := []struct {
+		id   int
+		name string
+		host string
+		want bool
+	}{
+		{name: "Service Name", id: 0, host: "al-dbcluster-sample-rw-ilb", want: true},
+		{name: "External Service In The Namespace", id: 1, host: "al-dbcluster-sample-rw-elb.db", want: true},
+		{name: "Cluster DNS Name", id: 2, host: "al-dbcluster-sample-rw-ilb.db.svc.cluster.local.", want: true},
+		{name: "Same Name In Another Namespace", id: 3, host: "al-dbcluster-sample-rw-ilb.dr.svc.cluster.local", want: false},
+		{name: "Address", id: 4, host: "10.10.10.10", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ownService(tt.host, "db", "dbcluster-sample"); got != tt.want {
+				t.Errorf("\t%s\tTest ID=%d::ownService(%s) = %t, want %t", failed, tt.id, tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+// setTestReplicationChecks serves the Replication validator over the dbcluster-sample & prod DBClusters of the db
+// namespace, prod having an upstream Replication already.
+func setTestReplicationChecks(t *testing.T) {
+
+	setTestAlloyDB(t,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "dbcluster-sample"}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "prod"}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Replication", "metadata": {"namespace": "db", "name": "prod-upstream"}, "spec": {"dbcluster": {"name": "prod"}, "upstream": {}}}`,
+	)
+	savedRoute := validatingRoutes["/validate/replication"]
+	registerValidator("/validate/replication", replicationKind, validateReplication)
+	t.Cleanup(func() {
+		if savedRoute == nil {
+			delete(validatingRoutes, "/validate/replication")
+		} else {
+			validatingRoutes["/validate/replication"] = savedRoute
+		}
+	})
+
+}
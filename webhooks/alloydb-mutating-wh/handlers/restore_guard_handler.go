@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"k8s.io/api/admission/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// BuildRestoreGuard serves the Restore validator at /validate/restore when RESTORE_GUARD is set to true, it watches
+// the DBClusters & the Backups the Restores refer to.
+func BuildRestoreGuard() {
+	value := os.Getenv("RESTORE_GUARD")
+	if value == "" {
+		return
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		configFailed("restore-guard", "handlers.BuildRestoreGuard():Invalid value %q for RESTORE_GUARD:: %v", value, err)
+		return
+	}
+	if !enabled {
+		return
+	}
+	watchAlloyDB(dbClusterResource, backupResource)
+	registerValidator("/validate/restore", restoreKind, validateRestore, "restore-guard", "alloydb")
+	log.Info("handlers.BuildRestoreGuard():Enabled the Restore validation")
+
+}
+
+// validateRestore denies the in place restores of a protected DBCluster without the break-glass annotation, the clones
+// onto an existing DBCluster & the restores from a Backup of another DBCluster.
+func validateRestore(req *validationRequest) (field.ErrorList, error) {
+
+	if req.ar.Request.Operation != v1beta1.Create {
+		return nil, nil
+	}
+	restore := &Restore{}
+	if err := json.Unmarshal(req.ar.Request.Object.Raw, restore); err != nil {
+		return nil, err
+	}
+	specPath := field.NewPath("spec")
+	errs := field.ErrorList{}
+	source := restore.Spec.SourceDBCluster
+
+	if clone := restore.Spec.ClonedDBClusterConfig; clone != nil {
+		namePath := specPath.Child("clonedDBClusterConfig", "dbclusterName")
+		switch {
+		case clone.DBClusterName == "":
+			errs = append(errs, field.Required(namePath, "a clone must name the new DBCluster"))
+		case clone.DBClusterName == source:
+			errs = append(errs, field.Invalid(namePath, clone.DBClusterName, "a clone must not target its source DBCluster, leave out clonedDBClusterConfig to restore in place"))
+		default:
+			_, err := alloyDB.getDBCluster(req.namespace, clone.DBClusterName)
+			if err == nil {
+				errs = append(errs, field.Invalid(namePath, clone.DBClusterName, "a clone must target a new DBCluster, this one already exists"))
+			} else if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("could not look up the DBCluster %s: %v", clone.DBClusterName, err)
+			}
+		}
+	} else if source != "" {
+		cluster, err := alloyDB.getDBCluster(req.namespace, source)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("could not look up the DBCluster %s: %v", source, err)
+		}
+		if err == nil && cluster.Labels[protectedLabel] == "true" {
+			if reason := restore.Annotations[breakGlassAnnotation]; reason == "" {
+				errs = append(errs, field.Forbidden(specPath.Child("sourceDBCluster"),
+					fmt.Sprintf("the DBCluster %s is labeled %s=true, restoring it in place needs the annotation %s set to the reason", source, protectedLabel, breakGlassAnnotation)))
+			} else {
+				log.Warningf("handlers.validateRestore():Break-glass restore in place of the protected DBCluster %s/%s by %s:: %s",
+					req.namespace, source, req.ar.Request.UserInfo.Username, reason)
+				req.warn("restoring the protected DBCluster %s in place with %s: %s", source, breakGlassAnnotation, reason)
+			}
+		}
+	}
+
+	if restore.Spec.Backup != "" {
+		backupPath := specPath.Child("backup")
+		backup, err := alloyDB.getBackup(req.namespace, restore.Spec.Backup)
+		switch {
+		case apierrors.IsNotFound(err):
+			errs = append(errs, field.NotFound(backupPath, restore.Spec.Backup))
+		case err != nil:
+			return nil, fmt.Errorf("could not look up the Backup %s: %v", restore.Spec.Backup, err)
+		case backup.Spec.DBClusterRef != source:
+			errs = append(errs, field.Invalid(backupPath, restore.Spec.Backup,
+				fmt.Sprintf("the Backup is of the DBCluster %s, not of the source DBCluster %s", backup.Spec.DBClusterRef, source)))
+		}
+	}
+	return errs, nil
+
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestValidateRestore(t *testing.T) {
+	tests := []struct {
+		id           int
+		name         string
+		object       string
+		allowed      bool
+		wantFields   []string
+		wantWarnings int
+	}{
+		{
+			name:       "In Place Restore Of A Protected Cluster",
+			id:         0,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Restore", "metadata": {"name": "restore1"}, "spec": {"sourceDBCluster": "prod", "backup": "prod-backup"}}`,
+			allowed:    false,
+			wantFields: []string{"spec.sourceDBCluster"},
+		},
+		{
+			name:         "Break-Glass Restore Of A Protected Cluster",
+			id:           1,
+			object:       `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Restore", "metadata": {"name": "restore1", "annotations": {"alloydb.cloud.google.com/break-glass": "INC-1234 corrupted orders table"}}, "spec": {"sourceDBCluster": "prod", "backup": "prod-backup"}}`,
+			allowed:      true,
+			wantWarnings: 1,
+		},
+		{
+			name:    "In Place Restore Of An Unprotected Cluster",
+			id:      2,
+			object:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Restore", "metadata": {"name": "restore1"}, "spec": {"sourceDBCluster": "staging", "backup": "staging-backup"}}`,
+			allowed: true,
+		},
+		{
+			name:       "Backup Of Another Cluster",
+			id:         3,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Restore", "metadata": {"name": "restore1"}, "spec": {"sourceDBCluster": "staging", "backup": "prod-backup"}}`,
+			allowed:    false,
+			wantFields: []string{"spec.backup"},
+		},
+		{
+			name:       "Missing Backup",
+			id:         4,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Restore", "metadata": {"name": "restore1"}, "spec": {"sourceDBCluster": "staging", "backup": "backup9"}}`,
+			allowed:    false,
+			wantFields: []string{"spec.backup"},
+		},
+		{
+			name:    "Clone Of A Protected Cluster",
+			id:      5,
+			object:  `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Restore", "metadata": {"name": "clone1"}, "spec": {"sourceDBCluster": "prod", "pointInTime": "2024-02-23T19:59:43Z", "clonedDBClusterConfig": {"dbclusterName": "prod-clone"}}}`,
+			allowed: true,
+		},
+		{
+			name:       "Clone Onto The Source",
+			id:         6,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Restore", "metadata": {"name": "clone1"}, "spec": {"sourceDBCluster": "prod", "pointInTime": "2024-02-23T19:59:43Z", "clonedDBClusterConfig": {"dbclusterName": "prod"}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.clonedDBClusterConfig.dbclusterName"},
+		},
+		{
+			name:       "Clone Onto An Existing Cluster",
+			id:         7,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Restore", "metadata": {"name": "clone1"}, "spec": {"sourceDBCluster": "staging", "backup": "staging-backup", "clonedDBClusterConfig": {"dbclusterName": "prod"}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.clonedDBClusterConfig.dbclusterName"},
+		},
+		{
+			name:       "Clone Without A Name",
+			id:         8,
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Restore", "metadata": {"name": "clone1"}, "spec": {"sourceDBCluster": "prod", "clonedDBClusterConfig": {}}}`,
+			allowed:    false,
+			wantFields: []string{"spec.clonedDBClusterConfig.dbclusterName"},
+		},
+	}
+
+	setTestRestoreGuard(t)
+	admit := validatingRoutes["/validate/restore"]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      "restore1",
+					Namespace: "db",
+					Operation: v1beta1.Create,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+				},
+			}
+			got := admit(ar, nil)
+
+			if got.Allowed != tt.allowed {
+				t.Fatalf("\t%s\tTest ID=%d::Got allowed %t, want %t:: %+v", failed, tt.id, got.Allowed, tt.allowed, got.Result)
+			}
+			if len(got.Warnings) != tt.wantWarnings {
+				t.Errorf("\t%s\tTest ID=%d::Got the warnings %v, want %d", failed, tt.id, got.Warnings, tt.wantWarnings)
+			}
+			if tt.allowed {
+				return
+			}
+			fields := []string{}
+			for _, cause := range got.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %s", failed, tt.id, fields, tt.wantFields, got.Result.Message)
+			}
+		})
+	}
+}
+
+// setTestRestoreGuard serves the Restore validator over a protected prod DBCluster & an unprotected staging one in
+// the db namespace, with a Backup of each.
+func setTestRestoreGuard(t *testing.T) {
+
+	setTestAlloyDB(t,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "prod", "labels": {"alloydb.cloud.google.com/protected": "true"}}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "DBCluster", "metadata": {"namespace": "db", "name": "staging"}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Backup", "metadata": {"namespace": "db", "name": "prod-backup"}, "spec": {"dbclusterRef": "prod"}}`,
+		`{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Backup", "metadata": {"namespace": "db", "name": "staging-backup"}, "spec": {"dbclusterRef": "staging"}}`,
+	)
+	savedRoute := validatingRoutes["/validate/restore"]
+	registerValidator("/validate/restore", restoreKind, validateRestore)
+	t.Cleanup(func() {
+		if savedRoute == nil {
+			delete(validatingRoutes, "/validate/restore")
+		} else {
+			validatingRoutes["/validate/restore"] = savedRoute
+		}
+	})
+
+}
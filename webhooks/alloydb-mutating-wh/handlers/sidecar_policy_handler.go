@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+// SidecarPolicy is the layout of the file pointed to by SIDECAR_POLICY_CONFIG_PATH & SIDECAR_POLICY_CONFIG_FILE.
+type SidecarPolicy struct {
+	// Registries the images must come from, like gcr.io/my-project or docker.io/commvault. An image without a registry
+	// is a docker.io one & an image without a namespace a docker.io/library one, as the container runtime reads them.
+	Registries []string `json:"registries,omitempty"`
+	// Digests allow single images of any registry pinned to a digest, like commvault/accessnode@sha256:<hex>.
+	Digests []string `json:"digests,omitempty"`
+	// RequireDigest denies the images pinned to a tag only.
+	RequireDigest bool `json:"requireDigest,omitempty"`
+	// RequiredLimits are the resource limits every sidecar must set, cpu & memory when left out.
+	RequiredLimits []corev1.ResourceName `json:"requiredLimits,omitempty"`
+	// ExemptNamespaces may run privileged sidecars & mount hostPath volumes.
+	ExemptNamespaces []string `json:"exemptNamespaces,omitempty"`
+}
+
+var sidecarPolicy *SidecarPolicy
+
+// BuildSidecarPolicy loads the Sidecar policy & serves its validator at /validate/sidecar when SIDECAR_POLICY_CONFIG_FILE
+// is set.
+func BuildSidecarPolicy() {
+	fileName := os.Getenv("SIDECAR_POLICY_CONFIG_FILE")
+	if fileName == "" {
+		return
+	}
+	filePath := filepath.Join(os.Getenv("SIDECAR_POLICY_CONFIG_PATH"), fileName)
+	registerValidator("/validate/sidecar", sidecarKind, validateSidecar, "sidecar-policy")
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		configFailed("sidecar-policy", "handlers.BuildSidecarPolicy():Error opening Sidecar policy config file %s:: %v", filePath, err)
+		return
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		configFailed("sidecar-policy", "handlers.BuildSidecarPolicy():Error reading the Sidecar policy from the file:: %v", err)
+		return
+	}
+	if sidecarPolicy, err = loadSidecarPolicy(data); err != nil {
+		configFailed("sidecar-policy", "handlers.BuildSidecarPolicy():Error loading the Sidecar policy from the file %s:: %v", filePath, err)
+		return
+	}
+	configLoaded("sidecar-policy", filePath, data)
+	log.Info("handlers.BuildSidecarPolicy():Enabled the Sidecar policy validation")
+
+}
+
+func loadSidecarPolicy(data []byte) (*SidecarPolicy, error) {
+
+	policy := &SidecarPolicy{}
+	if err := loadConfig(data, policy, policy.validate); err != nil {
+		return nil, err
+	}
+	for i, image := range policy.Digests {
+		repository, digest := splitImage(image)
+		policy.Digests[i] = repository + "@" + digest // Compared with the normalized images
+	}
+	if len(policy.RequiredLimits) == 0 {
+		policy.RequiredLimits = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+	}
+	return policy, nil
+
+}
+
+func (p *SidecarPolicy) validate() field.ErrorList {
+
+	errs := field.ErrorList{}
+	for i, registry := range p.Registries {
+		if strings.Trim(registry, "/") == "" {
+			errs = append(errs, field.Required(field.NewPath("registries").Index(i), "an empty registry allows every image, leave the list empty instead"))
+		}
+	}
+	for i, image := range p.Digests {
+		if _, digest := splitImage(image); !strings.Contains(digest, ":") {
+			errs = append(errs, field.Invalid(field.NewPath("digests").Index(i), image, "must be an image pinned to a digest like agent@sha256:<hex>"))
+		}
+	}
+	return errs
+
+}
+
+// validateSidecar enforces sidecarPolicy on the Sidecars created or updated.
+func validateSidecar(req *validationRequest) (field.ErrorList, error) {
+
+	if req.ar.Request.Operation != v1beta1.Create && req.ar.Request.Operation != v1beta1.Update {
+		return nil, nil
+	}
+	sidecar := &Sidecar{}
+	if err := json.Unmarshal(req.ar.Request.Object.Raw, sidecar); err != nil {
+		return nil, err
+	}
+	p := sidecarPolicy
+	specPath := field.NewPath("spec")
+	exempt := containsString(p.ExemptNamespaces, req.namespace)
+	errs := field.ErrorList{}
+
+	for i, c := range sidecar.Spec.Sidecars {
+		cPath := specPath.Child("sidecars").Index(i)
+		errs = append(errs, p.checkImage(c.Image, cPath.Child("image"))...)
+		for _, name := range p.RequiredLimits {
+			if _, ok := c.Resources.Limits[name]; !ok {
+				errs = append(errs, field.Required(cPath.Child("resources", "limits").Key(string(name)), "every sidecar must be limited"))
+			}
+		}
+		if !exempt && c.SecurityContext != nil && c.SecurityContext.Privileged != nil && *c.SecurityContext.Privileged {
+			errs = append(errs, field.Forbidden(cPath.Child("securityContext", "privileged"),
+				fmt.Sprintf("privileged sidecars are not allowed in the namespace %s", req.namespace)))
+		}
+	}
+	if !exempt {
+		for i, v := range sidecar.Spec.AdditionalVolumes {
+			if v.HostPath != nil {
+				errs = append(errs, field.Forbidden(specPath.Child("additionalVolumes").Index(i).Child("hostPath"),
+					fmt.Sprintf("hostPath volumes are not allowed in the namespace %s", req.namespace)))
+			}
+		}
+	}
+	return errs, nil
+
+}
+
+// checkImage returns the errors for an image neither in the allowed registries nor pinned to an allowed digest.
+func (p *SidecarPolicy) checkImage(image string, fldPath *field.Path) field.ErrorList {
+
+	if image == "" {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+	repository, digest := splitImage(image)
+	if digest == "" && p.RequireDigest {
+		return field.ErrorList{field.Invalid(fldPath, image, "must be pinned to a digest with image@sha256:<hex>")}
+	}
+	if len(p.Registries) == 0 && len(p.Digests) == 0 {
+		return nil
+	}
+	if inRegistries(repository, p.Registries) || (digest != "" && containsString(p.Digests, repository+"@"+digest)) {
+		return nil
+	}
+	allowed := append(append([]string{}, p.Registries...), p.Digests...)
+	return field.ErrorList{field.Invalid(fldPath, image, fmt.Sprintf("%s is not in the allowed registries or pinned to an allowed digest: %s", repository, strings.Join(allowed, ", ")))}
+
+}
+
+// splitImage returns the repository of the image with its registry & namespace filled in like the container runtime
+// does, along with the digest the image is pinned to.
+func splitImage(image string) (string, string) {
+
+	repository, digest, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i] // The tag
+	}
+	first, _, found := strings.Cut(repository, "/")
+	if !found || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		if !found {
+			repository = "library/" + repository
+		}
+		repository = "docker.io/" + repository
+	}
+	return repository, digest
+
+}
+
+// inRegistries tells if the repository is one of the registries or under one of them.
+func inRegistries(repository string, registries []string) bool {
+
+	for _, registry := range registries {
+		registry = strings.TrimSuffix(registry, "/")
+		if repository == registry || strings.HasPrefix(repository, registry+"/") {
+			return true
+		}
+	}
+	return false
+
+}
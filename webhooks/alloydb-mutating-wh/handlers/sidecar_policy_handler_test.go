@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		id             int
+		name           string
+		image          string
+		wantRepository string
+		wantDigest     string
+	}{
+		{name: "Official Image", id: 0, image: "busybox", wantRepository: "docker.io/library/busybox"},
+		{name: "Docker Hub Image With Tag", id: 1, image: "commvault/accessnode:11.32.42", wantRepository: "docker.io/commvault/accessnode"},
+		{name: "Registry With Port", id: 2, image: "registry.local:5000/tools/agent:1.0", wantRepository: "registry.local:5000/tools/agent"},
+		{name: "Pinned To A Digest", id: 3, image: "gcr.io/my-project/agent:1.0@sha256:abc", wantRepository: "gcr.io/my-project/agent", wantDigest: "sha256:abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository, digest := splitImage(tt.image)
+			if repository != tt.wantRepository || digest != tt.wantDigest {
+				t.Errorf("\t%s\tTest ID=%d::splitImage() = %s, %s, want %s, %s", failed, tt.id, repository, digest, tt.wantRepository, tt.wantDigest)
+			}
+		})
+	}
+}
+
+func TestValidateSidecar(t *testing.T) {
+	tests := []struct {
+		id         int
+		name       string
+		namespace  string
+		object     string
+		allowed    bool
+		wantFields []string
+	}{
+		{
+			name:      "Allowed Registry With Limits",
+			id:        0,
+			namespace: "db",
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Sidecar", "metadata": {"name": "sidecar-sample"}, "spec": {"sidecars": [{"name": "agent", "image": "gcr.io/my-project/agent:1.0", "resources": {"limits": {"cpu": "100m", "memory": "128Mi"}}}]}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Registry Sharing The Prefix",
+			id:         1,
+			namespace:  "db",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Sidecar", "metadata": {"name": "sidecar-sample"}, "spec": {"sidecars": [{"name": "agent", "image": "gcr.io/my-project-evil/agent:1.0", "resources": {"limits": {"cpu": "100m", "memory": "128Mi"}}}]}}`,
+			allowed:    false,
+			wantFields: []string{"spec.sidecars[0].image"},
+		},
+		{
+			name:       "Official Image Without Limits",
+			id:         2,
+			namespace:  "db",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Sidecar", "metadata": {"name": "sidecar-sample"}, "spec": {"sidecars": [{"name": "sidecar-sample", "image": "busybox", "resources": {"limits": {"cpu": "100m"}}}]}}`,
+			allowed:    false,
+			wantFields: []string{"spec.sidecars[0].image", "spec.sidecars[0].resources.limits[memory]"},
+		},
+		{
+			name:       "Docker Hub Image Pinned To A Tag",
+			id:         3,
+			namespace:  "db",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Sidecar", "metadata": {"name": "cv-sidecar-config"}, "spec": {"sidecars": [{"name": "commvault-pgsqlagent", "image": "commvault/accessnode:11.32.42", "resources": {"limits": {"cpu": "1", "memory": "1Gi"}}}]}}`,
+			allowed:    false,
+			wantFields: []string{"spec.sidecars[0].image"},
+		},
+		{
+			name:      "Docker Hub Image Pinned To An Allowed Digest",
+			id:        4,
+			namespace: "db",
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Sidecar", "metadata": {"name": "cv-sidecar-config"}, "spec": {"sidecars": [{"name": "commvault-pgsqlagent", "image": "commvault/accessnode:11.32.42@sha256:1111", "resources": {"limits": {"cpu": "1", "memory": "1Gi"}}}]}}`,
+			allowed:   true,
+		},
+		{
+			name:       "Privileged With Host Path",
+			id:         5,
+			namespace:  "db",
+			object:     `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Sidecar", "metadata": {"name": "sidecar-sample"}, "spec": {"sidecars": [{"name": "agent", "image": "gcr.io/my-project/agent:1.0", "resources": {"limits": {"cpu": "100m", "memory": "128Mi"}}, "securityContext": {"privileged": true}}], "additionalVolumes": [{"name": "host", "hostPath": {"path": "/var/lib"}}]}}`,
+			allowed:    false,
+			wantFields: []string{"spec.sidecars[0].securityContext.privileged", "spec.additionalVolumes[0].hostPath"},
+		},
+		{
+			name:      "Privileged With Host Path In An Exempt Namespace",
+			id:        6,
+			namespace: "backup-agents",
+			object:    `{"apiVersion": "alloydbomni.dbadmin.goog/v1", "kind": "Sidecar", "metadata": {"name": "sidecar-sample"}, "spec": {"sidecars": [{"name": "agent", "image": "gcr.io/my-project/agent:1.0", "resources": {"limits": {"cpu": "100m", "memory": "128Mi"}}, "securityContext": {"privileged": true}}], "additionalVolumes": [{"name": "host", "hostPath": {"path": "/var/lib"}}]}}`,
+			allowed:   true,
+		},
+	}
+
+	setTestSidecarPolicy(t)
+	admit := validatingRoutes["/validate/sidecar"]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					UID:       types.UID("70a7fc1a-a84b-4e9d-9e6e-500f45a4697b"),
+					Name:      "sidecar-sample",
+					Namespace: tt.namespace,
+					Operation: v1beta1.Create,
+					Object:    runtime.RawExtension{Raw: []byte(tt.object)},
+				},
+			}
+			got := admit(ar, nil)
+
+			if got.Allowed != tt.allowed {
+				t.Fatalf("\t%s\tTest ID=%d::Got allowed %t, want %t:: %+v", failed, tt.id, got.Allowed, tt.allowed, got.Result)
+			}
+			if tt.allowed {
+				return
+			}
+			fields := []string{}
+			for _, cause := range got.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("\t%s\tTest ID=%d::Got denied fields %v, want %v:: %s", failed, tt.id, fields, tt.wantFields, got.Result.Message)
+			}
+		})
+	}
+}
+
+// setTestSidecarPolicy allows the images of the my-project GCR repositories & a single digest of the commvault agent.
+func setTestSidecarPolicy(t *testing.T) {
+
+	policy, err := loadSidecarPolicy([]byte(`
+registries: [gcr.io/my-project/]
+digests: ["commvault/accessnode@sha256:1111"]
+exemptNamespaces: [backup-agents]
+`))
+	if err != nil {
+		t.Fatalf("\t%s\tCould not load the Sidecar policy:: %v", failed, err)
+	}
+	savedPolicy, savedRoute := sidecarPolicy, validatingRoutes["/validate/sidecar"]
+	sidecarPolicy = policy
+	registerValidator("/validate/sidecar", sidecarKind, validateSidecar)
+	t.Cleanup(func() {
+		sidecarPolicy = savedPolicy
+		if savedRoute == nil {
+			delete(validatingRoutes, "/validate/sidecar")
+		} else {
+			validatingRoutes["/validate/sidecar"] = savedRoute
+		}
+	})
+
+}
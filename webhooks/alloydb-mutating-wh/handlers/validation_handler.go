@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	log "k8s.io/klog/v2"
+)
+
+const (
+	protectedLabel       = "alloydb.cloud.google.com/protected"   // "true" on the resources the validators guard against data loss
+	breakGlassAnnotation = "alloydb.cloud.google.com/break-glass" // The reason, lets a guarded operation through & is logged
+)
+
+// validator checks an AlloyDB resource & returns the field errors it's denied for, an error denies it as well when
+// the validator couldn't decide.
+type validator func(*validationRequest) (field.ErrorList, error)
+
+// validationRequest carries the admission request & what the validators look up for it, like mutationRequest.
+type validationRequest struct {
+	ar        *v1beta1.AdmissionReview
+	namespace string
+	ns        *corev1.Namespace // Looked up on demand with getNamespace()
+	warnings  []string
+}
+
+var validatingRoutes = map[string]AdmitFunc{} // Keyed by the path, registered by the Build functions at start up
+
+// registerValidator serves the validator at path, the resource is denied with an Invalid status naming the fields.
+// The failure mode answers instead of the validator while one of the configs it uses is broken, so the Build functions
+// register it before loading them.
+func registerValidator(path string, kind schema.GroupKind, v validator, configs ...string) {
+	validatingRoutes[path] = validating(kind, v, configs)
+}
+
+// validating adapts a validator to the AdmitFunc serve() expects, the tolerations are of no use to it.
+func validating(kind schema.GroupKind, v validator, configs []string) AdmitFunc {
+	return func(ar *v1beta1.AdmissionReview, _ []corev1.Toleration) *v1beta1.AdmissionResponse {
+
+		if resp := configFailureResponse(ar, fmt.Sprintf("%s was not validated", kind.Kind), configs...); resp != nil {
+			return resp
+		}
+		req := &validationRequest{ar: ar, namespace: ar.Request.Namespace}
+		errs, err := v(req)
+		if err != nil {
+			log.Errorf("handlers.validating():Could not validate the %s %s/%s:: %v", kind.Kind, req.namespace, ar.Request.Name, err)
+			return &v1beta1.AdmissionResponse{
+				UID:      ar.Request.UID,
+				Allowed:  false,
+				Warnings: req.warnings,
+				Result: &metav1.Status{
+					Message: err.Error(),
+				},
+			}
+		}
+		if len(errs) != 0 {
+			status := apierrors.NewInvalid(kind, ar.Request.Name, errs).ErrStatus
+			log.Infof("handlers.validating():Denied the %s %s/%s:: %s", kind.Kind, req.namespace, ar.Request.Name, status.Message)
+			return &v1beta1.AdmissionResponse{
+				UID:      ar.Request.UID,
+				Allowed:  false,
+				Warnings: req.warnings,
+				Result:   &status,
+			}
+		}
+		return &v1beta1.AdmissionResponse{
+			UID:      ar.Request.UID,
+			Allowed:  true,
+			Warnings: req.warnings,
+			Result: &metav1.Status{
+				Status: "Success",
+			},
+		}
+
+	}
+}
+
+func (req *validationRequest) getNamespace() (*corev1.Namespace, error) {
+
+	if req.ns != nil {
+		return req.ns, nil
+	}
+	ns, err := namespaces.Get(req.namespace)
+	if err != nil {
+		return nil, err
+	}
+	req.ns = ns
+	return ns, nil
+
+}
+
+func (req *validationRequest) warn(format string, args ...interface{}) {
+	req.warnings = append(req.warnings, fmt.Sprintf(format, args...))
+}
+
+// routeAdmissions registers the validators or the mutators of the AlloyDB resources with the HTTP server, called from
+// Routes().
+func routeAdmissions(routes map[string]AdmitFunc) {
+	for path, admit := range routes {
+		admit := admit
+		http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			serve(w, r, admit)
+		})
+		log.Infof("handlers.Routes():Registered the handler for the path %s", path)
+	}
+}
@@ -2,26 +2,106 @@ package main
 
 import (
 	"crypto/tls"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
 
 	"github.com/rmishgoog/alloydb-omni-mwh/handlers"
 )
 
+// Set at build time with -ldflags "-X main.version=... -X main.commit=...".
+var (
+	version = "dev"
+	commit  = ""
+)
+
+const usage = `Usage: alloywebhook <command> [flags]
+
+Commands:
+  serve                        Run the webhook server, the default when no command is given
+  validate-config [-kind k] <file>
+                               Check a config file & print every error with its line, exits 1 when invalid
+  version                      Print the build info
+
+Run alloywebhook <command> -h for the flags of a command.
+`
+
 func main() {
 
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) != 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+		serve(args)
+	case "validate-config":
+		os.Exit(validateConfig(args))
+	case "version":
+		printVersion()
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+}
+
+// serve runs the webhook, the flags take precedence over the environment variables of the same settings, which are
+// what the Build functions of the handlers read.
+func serve(args []string) {
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	tolerationConfigPath := fs.String("toleration-config-path", os.Getenv("TOLERATION_CONFIG_PATH"), "Directory of the tolerations config file, defaults to $TOLERATION_CONFIG_PATH")
+	tolerationConfigFile := fs.String("toleration-config-file", os.Getenv("TOLERATION_CONFIG_FILE"), "Name of the tolerations config file, defaults to $TOLERATION_CONFIG_FILE")
+	tlsCertRoot := fs.String("tls-cert-root-dir", os.Getenv("TLS_CERT_ROOT_DIR"), "Directory holding tls.crt & tls.key, defaults to $TLS_CERT_ROOT_DIR")
+	port := fs.String("port", os.Getenv("CONTAINER_PORT"), "Port to listen on, defaults to $CONTAINER_PORT or 8443")
+	failureMode := fs.String("failure-mode", os.Getenv("FAILURE_MODE"), "fail-closed, fail-open or not-ready when a config can't be loaded, defaults to $FAILURE_MODE or fail-closed")
+	fs.Parse(args)
+	os.Setenv("FAILURE_MODE", *failureMode)
+	os.Setenv("TOLERATION_CONFIG_PATH", *tolerationConfigPath)
+	os.Setenv("TOLERATION_CONFIG_FILE", *tolerationConfigFile)
+
+	log.Printf("main.serve()::Starting the webhook %s", versionString())
+	handlers.BuildFailureMode()
+	handlers.BuildAuditLog()
+	handlers.BuildDryRun()
 	handlers.BuildTolerations()
+	handlers.BuildSelectors()
+	handlers.BuildRolePlacements()
+	handlers.BuildFailoverTolerations()
+	handlers.BuildOpenShiftMode()
+	handlers.BuildRules()
+	handlers.BuildNamespaceOverrides()
+	handlers.BuildPlacementPolicies()
+	handlers.BuildAnnotations()
+	handlers.BuildDBClusterPolicy()
+	handlers.BuildDBClusterUpdatePolicy()
+	handlers.BuildMajorUpgradeGuard()
+	handlers.BuildBackupPlanPolicy()
+	handlers.BuildRestoreGuard()
+	handlers.BuildReplicationChecks()
+	handlers.BuildReadPoolQuotas()
+	handlers.BuildDeletionProtection()
+	handlers.BuildChangeWindows()
+	handlers.BuildSidecarPolicy()
+	handlers.BuildDBClusterDefaulting()
+	handlers.BuildDebug()
 	handlers.Routes()
 
-	tlsCertRoot := os.Getenv("TLS_CERT_ROOT_DIR")
-	if tlsCertRoot == "" {
+	if *tlsCertRoot == "" {
 		log.Fatalf("main()::TLS_CERT_ROOT_DIR environment variables must be set, could not load the certifcates, exiting")
 	}
 
-	certFile := filepath.Join(tlsCertRoot, "tls.crt")
-	keyFile := filepath.Join(tlsCertRoot, "tls.key")
+	certFile := filepath.Join(*tlsCertRoot, "tls.crt")
+	keyFile := filepath.Join(*tlsCertRoot, "tls.key")
 
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
@@ -31,16 +111,76 @@ func main() {
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{cert},
 	}
-	port := os.Getenv("CONTAINER_PORT")
-	if port == "" {
-		port = "8443"
+	if *port == "" {
+		*port = "8443"
 	}
 	tlsServer := &http.Server{
-		Addr:      "" + ":" + port,
+		Addr:      "" + ":" + *port,
 		TLSConfig: tlsConfig,
 	}
 	if err := tlsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("main()::Could not start the webhook server at port %s, exiting with error %v", port, err)
+		log.Fatalf("main()::Could not start the webhook server at port %s, exiting with error %v", *port, err)
+	}
+
+}
+
+// validateConfig returns the exit code, 1 when the file is invalid & 2 when the command is misused.
+func validateConfig(args []string) int {
+
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	kind := fs.String("kind", "tolerations", fmt.Sprintf("Kind of the config file, one of %v", handlers.ConfigKinds()))
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: alloywebhook validate-config [-kind k] <file>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
 	}
+	fileName := fs.Arg(0)
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if err := handlers.ValidateConfig(*kind, data); err != nil {
+		fmt.Fprintf(os.Stderr, "%s is not a valid %s config:\n", fileName, *kind)
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				fmt.Fprintf(os.Stderr, "  %s: %v\n", fileName, e)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "  %s: %v\n", fileName, err)
+		}
+		return 1
+	}
+	fmt.Printf("%s is a valid %s config\n", fileName, *kind)
+	return 0
 
 }
+
+func printVersion() {
+
+	fmt.Printf("alloywebhook %s\n", versionString())
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Printf("  module: %s\n", info.Main.Path)
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				fmt.Printf("  %s: %s\n", setting.Key, setting.Value)
+			}
+		}
+	}
+
+}
+
+func versionString() string {
+	v := version
+	if commit != "" {
+		v += " (" + commit + ")"
+	}
+	return fmt.Sprintf("%s %s %s/%s", v, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}